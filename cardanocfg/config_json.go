@@ -2,6 +2,7 @@ package cardanocfg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -179,7 +180,7 @@ func (d *Downloader) SetPrometheus(newJSON []byte) ([]byte, error) {
 	return newJSON, err
 }
 
-func (d *Downloader) GetConfigJSON(aType string) (filePath string, err error) {
+func (d *Downloader) GetConfigJSON(ctx context.Context, aType string) (filePath string, err error) {
 	var filePathTmp string
 	var url string
 	if filePathTmp, err = d.GetFilePath(aType, true); err != nil {
@@ -193,7 +194,7 @@ func (d *Downloader) GetConfigJSON(aType string) (filePath string, err error) {
 	if url, err = d.GetURL(aType); err != nil {
 		return filePath, err
 	}
-	if er := d.DownloadFile(filePathTmp, url); er != nil {
+	if er := d.DownloadFile(ctx, filePathTmp, url); er != nil {
 		return filePath, er
 	}
 
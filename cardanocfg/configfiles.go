@@ -1,8 +1,8 @@
 package cardanocfg
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,13 +14,22 @@ import (
 	"github.com/thedevsaddam/gojsonq"
 
 	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/fastping"
+	"github.com/adakailabs/gocnode/geoip"
 	l "github.com/adakailabs/gocnode/logger"
+	"github.com/adakailabs/gocnode/pathtrace"
 	"go.uber.org/zap"
 )
 
 const Testnet = "testnet"
 const Mainnet = "mainnet"
-const URI = "https://hydra.iohk.io/job/Cardano/cardano-node/cardano-deployment/latest-finished/download/1"
+
+// network magics used until the shelley genesis file is downloaded
+const (
+	MainnetMagic = 764824073
+	TestnetMagic = 1097911063
+)
+const URI = config.ConfigURI
 const ConfigJSON = "config.json"
 const ByronGenesis = "byron-genesis.json"
 const ShelleyGenesis = "shelley-genesis.json"
@@ -33,14 +42,24 @@ type Downloader struct {
 	node             *config.Node
 	relaysStream     chan Node
 	relaysStreamDone chan interface{}
-	Wg               *sync.WaitGroup
-	ConfigJSON       string
-	TopologyJSON     string
-	ShelleyGenesis   string
-	AlonzoGenesis    string
-	ByronGenesis     string
 
 	relaysMap map[string]string
+	filter    *PeerFilter
+	client    *http.Client
+	demoter   *demoter
+
+	topologyMu sync.Mutex
+	lastDiff   TopologyDiff
+
+	geoOnce sync.Once
+	geo     *geoip.DB
+	geoErr  error
+
+	compositionMu sync.Mutex
+	composition   Composition
+
+	curatedMu sync.Mutex
+	curated   map[string]bool
 }
 
 type Topology struct {
@@ -78,23 +97,59 @@ type Node struct {
 	Latency         time.Duration
 	LatencyAcc      time.Duration
 	LatencyAccCount uint64
+
+	Geo geoip.Info `json:"-"`
+	// Stats holds the last latency measurement and how it was taken
+	Stats fastping.Result `json:"-"`
+	// Path is set when path analysis traced the route to the peer
+	Path *pathtrace.Path `json:"-"`
+	// Internal is set for the pool's own nodes and the configured peers,
+	// as opposed to peers discovered from public lists
+	Internal bool `json:"-"`
+}
+
+// SetLatency records a latency sample, Latency holds the average of all the
+// samples recorded so far.
+func (n *Node) SetLatency(latency time.Duration) {
+	n.LatencyAcc += latency
+	n.LatencyAccCount++
+	n.Latency = n.LatencyAcc / time.Duration(n.LatencyAccCount)
+}
+
+func (n *Node) GetLatency() time.Duration {
+	return n.Latency
 }
 
 func New(n *config.Node, c *config.C) (*Downloader, error) {
 	var err error
 	d := &Downloader{}
-	d.Wg = &sync.WaitGroup{}
 	d.conf = c
 	d.node = n
 	d.relaysStream = make(chan Node)
 	d.relaysStreamDone = make(chan interface{})
+	d.demoter = newDemoter(n.Demotion)
+	if d.client, err = NewHTTPClient(c.HTTP); err != nil {
+		return d, err
+	}
 	if d.log, err = l.NewLogConfig(c, "config"); err != nil {
 		return d, err
 	}
+	if d.filter, err = NewPeerFilter(n.PeerFilter); err != nil {
+		return d, errors.Annotatef(err, "node %s", n.Name)
+	}
 
 	return d, nil
 }
 
+// FilterPeers applies the node's allow and block lists to nodes.
+func (d *Downloader) FilterPeers(nodes NodeList) NodeList {
+	filtered := d.filter.Apply(nodes)
+	if dropped := len(nodes) - len(filtered); dropped > 0 {
+		d.log.Infof("peer filter dropped %d of %d peers", dropped, len(nodes))
+	}
+	return filtered
+}
+
 func (d *Downloader) GetFilePath(aType string, isTmp bool) (filePath string, err error) {
 	filePath = fmt.Sprintf("%s/config/%s-%s",
 		d.node.TmpDir,
@@ -128,157 +183,120 @@ func (d *Downloader) RelaysDone() chan interface{} {
 }
 
 func (d *Downloader) GetURL(aType string) (url string, err error) {
-	url = fmt.Sprintf("%s/%s-%s", URI, d.node.Network, aType)
+	url = fmt.Sprintf("%s/%s-%s", d.conf.ConfigURI, d.node.Network, aType)
 	return url, err
 }
 
-func (d *Downloader) DownloadConfigFiles() (configJSON, topology, shelley, byron, alonzo string) {
-	filesToGet := []string{
-		ConfigJSON,
-		TopologyJSON,
-		ShelleyGenesis,
-		//AlonzoGenesis,
-		ByronGenesis,
-	}
+// ConfigFiles holds the paths of the files prepared for cardano-node and
+// the network magic read from the genesis.
+type ConfigFiles struct {
+	ConfigJSON     string
+	Topology       string
+	ShelleyGenesis string
+	ByronGenesis   string
+	NetworkMagic   uint64
+}
 
-	d.Wg.Add(len(filesToGet))
+// DownloadConfigFiles downloads and prepares all the files cardano-node
+// needs. The genesis files and config.json are fetched concurrently, the
+// network magic is then set on the node and only after that the topology,
+// which may depend on it, is built. The returned error aggregates the
+// errors of every file that could not be prepared.
+func (d *Downloader) DownloadConfigFiles(ctx context.Context) (files ConfigFiles, err error) {
+	var downloadErrors DownloadErrors
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+
+	step := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if er := f(); er != nil {
+				d.log.Error(er.Error())
+				mu.Lock()
+				downloadErrors = append(downloadErrors, er)
+				mu.Unlock()
+			}
+		}()
+	}
 
-	for _, f := range filesToGet {
-		go d.GetConfigFile(f)
+	var configJSON, byron, shelley string
+	var magic uint64
+	step(func() (er error) {
+		configJSON, er = d.GetConfigJSON(ctx, ConfigJSON)
+		return er
+	})
+	step(func() (er error) {
+		byron, er = d.GetConfigFile(ctx, ByronGenesis)
+		return er
+	})
+	step(func() (er error) {
+		shelley, magic, er = d.GetGenesis(ctx, ShelleyGenesis)
+		return er
+	})
+	wg.Wait()
+
+	files.ConfigJSON = configJSON
+	files.ByronGenesis = byron
+	files.ShelleyGenesis = shelley
+	if len(downloadErrors) > 0 {
+		return files, downloadErrors
 	}
 
-	d.Wg.Wait()
+	files.NetworkMagic = magic
+	d.node.NetworkMagic = magic
+	d.log.Infof("node %s network magic: %d", d.node.Name, d.node.NetworkMagic)
 
-	d.log.Info("config file: ", d.ConfigJSON)
-	d.log.Info("topology file: ", d.TopologyJSON)
+	if files.Topology, err = d.GetFilePath(TopologyJSON, false); err != nil {
+		return files, err
+	}
+	if err = d.DownloadAndSetTopologyFile(ctx); err != nil {
+		return files, DownloadErrors{errors.Annotatef(err, "setting topology: %s", files.Topology)}
+	}
+
+	d.log.Info("config file: ", files.ConfigJSON)
+	d.log.Info("topology file: ", files.Topology)
 
-	return d.ConfigJSON, d.TopologyJSON, d.ShelleyGenesis, d.ByronGenesis, d.AlonzoGenesis
+	return files, nil
 }
 
-func (d *Downloader) GetConfigFile(aType string) {
+// GetConfigFile downloads the file of type aType, as published for the
+// node's network, and returns its local path.
+func (d *Downloader) GetConfigFile(ctx context.Context, aType string) (filePath string, err error) {
 	var url string
-	var err error
-	var filePath string
-	var recent bool
 	if filePath, err = d.GetFilePath(aType, false); err != nil {
-		err = errors.Annotatef(err, "getting path for: %s", filePath)
-		panic(err.Error())
+		return filePath, errors.Annotatef(err, "getting path for: %s", aType)
 	}
 
-	statInfo, err := os.Stat(filePath)
-
-	if err == nil {
-		fTime := statInfo.ModTime()
-		eDuration := time.Since(fTime).Hours()
+	if statInfo, er := os.Stat(filePath); er == nil {
+		eDuration := time.Since(statInfo.ModTime()).Hours()
 		d.log.Info("Duration: ", eDuration)
 		if eDuration < 24*5 {
 			d.log.Info("file is recent: ", filePath)
-			// recent = true
+			//FIXME: recent files are downloaded again
 		}
 	}
 
-	recent = false //FIXME: overriding recent
-
-	switch aType {
-	case ConfigJSON:
-
-		filePath, err = d.GetConfigJSON(aType)
-		if err != nil {
-			err = errors.Annotatef(err, "getting path for: %s", filePath)
-			panic(err.Error())
-		}
-		d.ConfigJSON = filePath
-		d.Wg.Done()
-
-	case ByronGenesis:
-		if !recent {
-			if url, err = d.GetURL(aType); err != nil {
-				err = errors.Annotatef(err, "getting path for: %s", filePath)
-				panic(err.Error())
-			}
-			err = d.DownloadFile(filePath, url)
-			if err != nil {
-				err = errors.Annotatef(err, "getting path for: %s", filePath)
-				panic(err.Error())
-			}
-		}
-		d.ByronGenesis = filePath
-		d.Wg.Done()
-	case ShelleyGenesis:
-		if !recent {
-			if url, err = d.GetURL(aType); err != nil {
-				err = errors.Annotatef(err, "getting path for: %s", filePath)
-				panic(err.Error())
-			}
-			err = d.DownloadFile(filePath, url)
-			if err != nil {
-				err = errors.Annotatef(err, "getting path for: %s", filePath)
-				panic(err.Error())
-			}
-		}
-		jq := gojsonq.New().File(filePath)
-
-		d.node.NetworkMagic = uint64(jq.From("networkMagic").Get().(float64))
-		d.log.Infof("node %s network magic: %d", d.node.Name, d.node.NetworkMagic)
-		d.ShelleyGenesis = filePath
-		d.Wg.Done()
-
-	case AlonzoGenesis:
-		if !recent {
-			if url, err = d.GetURL(aType); err != nil {
-				err = errors.Annotatef(err, "getting path for: %s", filePath)
-				panic(err.Error())
-			}
-			err = d.DownloadFile(filePath, url)
-			if err != nil {
-				err = errors.Annotatef(err, "getting path for: %s", filePath)
-				panic(err.Error())
-			}
-		}
-		jq := gojsonq.New().File(filePath)
-
-		d.node.NetworkMagic = uint64(jq.From("networkMagic").Get().(float64))
-		d.log.Infof("node %s network magic: %d", d.node.Name, d.node.NetworkMagic)
-		d.AlonzoGenesis = filePath
-		d.Wg.Done()
-
-	case TopologyJSON:
-		err = d.DownloadAndSetTopologyFile()
-		d.TopologyJSON = filePath
-		d.Wg.Done()
-
-	default:
-		panic(fmt.Errorf("bad type"))
+	if url, err = d.GetURL(aType); err != nil {
+		return filePath, errors.Annotatef(err, "getting url for: %s", filePath)
+	}
+	if err = d.DownloadFile(ctx, filePath, url); err != nil {
+		return filePath, errors.Annotatef(err, "getting path for: %s", filePath)
 	}
+	return filePath, nil
 }
 
-// DownloadFile will download a url to a local file. It's efficient because it will
-// write as it downloads and not load the whole file into memory.
-func (d *Downloader) DownloadFile(filePath, url string) error {
-	d.log.Info("downloading from URL: ", url)
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		fmt.Println(resp)
-		fmt.Println(err.Error())
-		return err
+// GetGenesis downloads a genesis file and returns its path and the network
+// magic it declares.
+func (d *Downloader) GetGenesis(ctx context.Context, aType string) (filePath string, magic uint64, err error) {
+	if filePath, err = d.GetConfigFile(ctx, aType); err != nil {
+		return filePath, 0, err
 	}
-	defer resp.Body.Close()
 
-	// Create the file
-	d.log.Info("creatind dir: ", filepath.Dir(filePath))
-	if er := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); er != nil {
-		return er
+	jq := gojsonq.New().File(filePath)
+	m, ok := jq.From("networkMagic").Get().(float64)
+	if !ok {
+		return filePath, 0, errors.Errorf("networkMagic not found in: %s", filePath)
 	}
-	out, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	d.log.Info("saved to file: ", filePath)
-
-	return err
+	return filePath, uint64(m), nil
 }
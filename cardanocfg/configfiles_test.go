@@ -1,6 +1,7 @@
 package cardanocfg_test
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -42,7 +43,8 @@ func TestConfig(t *testing.T) {
 	d, err2 := cardanocfg.New(&c.Relays[0], c)
 	a.Nil(err2)
 
-	d.DownloadConfigFiles()
+	_, err = d.DownloadConfigFiles(context.Background())
+	a.Nil(err)
 }
 
 func TestConfigTopology(t *testing.T) {
@@ -54,14 +56,7 @@ func TestConfigTopology(t *testing.T) {
 	d, err2 := cardanocfg.New(&c.Relays[0], c)
 	a.Nil(err2)
 
-	files := []string{
-		cardanocfg.TopologyJSON,
-	}
-	d.Wg.Add(len(files))
-
-	for _, file := range files {
-		d.GetConfigFile(file)
-	}
+	a.Nil(d.DownloadAndSetTopologyFile(context.Background()))
 }
 
 func TestConfigTopologyProducer(t *testing.T) {
@@ -74,13 +69,7 @@ func TestConfigTopologyProducer(t *testing.T) {
 	d, err2 := cardanocfg.New(&c.Producers[0], c)
 	a.Nil(err2)
 
-	files := []string{
-		cardanocfg.TopologyJSON,
-	}
-
-	for _, file := range files {
-		d.GetConfigFile(file)
-	}
+	a.Nil(d.DownloadAndSetTopologyFile(context.Background()))
 }
 
 func TestConfigTestnetTopology(t *testing.T) {
@@ -96,7 +85,7 @@ func TestConfigTestnetTopology(t *testing.T) {
 		t.FailNow()
 	}
 
-	relays, err3 := d.TestNetRelays()
+	relays, err3 := d.TestNetRelays(context.Background())
 	if !a.Nil(err3) {
 		t.FailNow()
 	}
@@ -117,12 +106,12 @@ func TestConfigTestnetOptimzer(t *testing.T) {
 		t.FailNow()
 	}
 
-	_, relays, err3 := d.GetTestNetRelays()
+	_, relays, err3 := d.GetTestNetRelays(context.Background())
 	if !a.Nil(err3) {
 		t.FailNow()
 	}
 
-	_, relays, err4 := d.TestLatencyWithPing(relays)
+	_, relays, err4 := d.TestLatencyWithPing(context.Background(), relays)
 	if !a.Nil(err4) {
 		t.FailNow()
 	}
@@ -187,13 +176,13 @@ func TestValency(t *testing.T) {
 
 func TestPinger(t *testing.T) {
 	a := assert.New(t)
-	pTime, _, err := fastping.TestAddress("www.google.com")
+	res, err := fastping.TestAddress("www.google.com")
 
 	if !a.Nil(err) {
 		t.FailNow()
 	}
 
-	t.Log("time: ", pTime)
+	t.Log("time: ", res.AvgRtt)
 }
 
 func TestConfigDownloadAndSetTopology(t *testing.T) {
@@ -205,7 +194,7 @@ func TestConfigDownloadAndSetTopology(t *testing.T) {
 	d, err2 := cardanocfg.New(&c.Relays[0], c)
 	a.Nil(err2)
 
-	err3 := d.DownloadAndSetTopologyFile()
+	err3 := d.DownloadAndSetTopologyFile(context.Background())
 	a.Nil(err3)
 
 	time.Sleep(time.Second * 30)
@@ -221,7 +210,7 @@ func TestConfigMainnetTopology(t *testing.T) {
 	d, err2 := cardanocfg.New(&c.Relays[0], c)
 	a.Nil(err2)
 
-	relays, err3 := d.MainNetRelays()
+	relays, err3 := d.MainNetRelays(context.Background())
 	a.Nil(err3)
 
 	pp.Print(relays)
@@ -257,7 +246,7 @@ func TestTraceRouteGoogle(t *testing.T) {
 //		t.FailNow()
 //	}
 //
-//	_, relays, err3 := d.GetTestNetRelays()
+//	_, relays, err3 := d.GetTestNetRelays(context.Background())
 //	if !a.Nil(err3) {
 //		t.FailNow()
 //	}
@@ -0,0 +1,251 @@
+package cardanocfg
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+// demoter keeps track of the peers cardano-node reports as failing. Once a
+// peer fails Threshold times within Window it is removed from the topology,
+// replaced by the best spare candidate of the last selection, and kept out
+// of the topology for Cooldown.
+type demoter struct {
+	conf config.Demotion
+	now  func() time.Time
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	cooldown map[string]time.Time
+	spares   NodeList
+}
+
+func newDemoter(conf config.Demotion) *demoter {
+	return &demoter{
+		conf:     conf,
+		now:      time.Now,
+		failures: make(map[string][]time.Time),
+		cooldown: make(map[string]time.Time),
+	}
+}
+
+func peerKey(addr string, port uint) string {
+	return net.JoinHostPort(normalizeHost(addr), strconv.Itoa(int(port)))
+}
+
+// record adds a failure for peer and reports whether the threshold has been
+// reached.
+func (m *demoter) record(peer string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	recent := m.failures[peer][:0]
+	for _, t := range m.failures[peer] {
+		if m.conf.Window == 0 || now.Sub(t) < m.conf.Window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	m.failures[peer] = recent
+
+	return uint(len(recent)) >= m.conf.Threshold
+}
+
+func (m *demoter) startCooldown(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until := m.now().Add(m.conf.Cooldown)
+	for _, k := range keys {
+		m.cooldown[k] = until
+		delete(m.failures, k)
+	}
+}
+
+func (m *demoter) inCooldown(n *Node) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := peerKey(n.Addr, n.Port)
+	until, ok := m.cooldown[k]
+	if !ok {
+		return false
+	}
+	if m.now().After(until) {
+		delete(m.cooldown, k)
+		return false
+	}
+	return true
+}
+
+func (m *demoter) setSpares(spares NodeList) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spares = spares
+}
+
+// nextSpare returns the best spare that is not in cooldown and for which
+// used returns false.
+func (m *demoter) nextSpare(used func(n *Node) bool) (Node, bool) {
+	m.mu.Lock()
+	spares := m.spares
+	m.mu.Unlock()
+
+	for i := range spares {
+		if m.inCooldown(&spares[i]) || used(&spares[i]) {
+			continue
+		}
+		return spares[i], true
+	}
+	return Node{}, false
+}
+
+// excludeCooldown removes the peers in cooldown from nodes.
+func (d *Downloader) excludeCooldown(nodes NodeList) NodeList {
+	filtered := make(NodeList, 0, len(nodes))
+	for i := range nodes {
+		if d.demoter.inCooldown(&nodes[i]) {
+			d.log.Infof("skipping peer %s:%d, it was demoted recently", nodes[i].Addr, nodes[i].Port)
+			continue
+		}
+		filtered = append(filtered, nodes[i])
+	}
+	return filtered
+}
+
+// PeerFailed records a failure reported by cardano-node for peer, given as
+// ip:port. When the peer reaches the configured threshold it is replaced
+// in the node's topology file by the next best candidate, the running
+// cardano-node uses the new topology from its next start. PeerFailed
+// resolves hosts and writes the topology file, it must not be called from
+// the goroutine reading cardano-node's output.
+func (d *Downloader) PeerFailed(peer string) {
+	if d.node.Demotion.Disabled || d.node.IsProducer {
+		return
+	}
+
+	host, port, err := net.SplitHostPort(peer)
+	if err != nil {
+		d.log.Warnf("bad peer address reported: %s", peer)
+		return
+	}
+
+	if !d.demoter.record(peerKey(host, parsePort(port))) {
+		return
+	}
+
+	if err := d.demotePeer(host, parsePort(port)); err != nil {
+		d.log.Errorf("while demoting peer %s: %s", peer, err.Error())
+	}
+}
+
+func parsePort(port string) uint {
+	p, _ := strconv.ParseUint(port, 10, 16)
+	return uint(p)
+}
+
+// isProtected reports whether n is one of the peers configured for the
+// node, those are never demoted.
+func (d *Downloader) isProtected(n *Node) bool {
+	if d.filter.isPinned(n) || d.isCurated(n) {
+		return true
+	}
+	for _, p := range d.node.Producers {
+		if normalizeHost(p.Host) == normalizeHost(n.Addr) && p.Port == n.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvesTo reports whether addr is, or resolves to, ip.
+func resolvesTo(addr string, ip net.IP) bool {
+	if aIP := net.ParseIP(addr); aIP != nil {
+		return aIP.Equal(ip)
+	}
+	ips, err := net.LookupIP(addr)
+	if err != nil {
+		return false
+	}
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Downloader) demotePeer(host string, port uint) error {
+	filePath, err := d.GetFilePath(TopologyJSON, false)
+	if err != nil {
+		return err
+	}
+
+	return d.updateTopology(filePath, func(top Topology) (Topology, error) {
+		return d.demoteFrom(top, host, port), nil
+	})
+}
+
+// demoteFrom returns top without the entries of the failing peer
+// host:port, replaced by spare candidates.
+func (d *Downloader) demoteFrom(top Topology, host string, port uint) Topology {
+	ip := net.ParseIP(host)
+	demoted := make([]string, 0, 2)
+	producers := make(NodeList, 0, len(top.Producers))
+	for i := range top.Producers {
+		p := &top.Producers[i]
+		if p.Port == port && !d.isProtected(p) && (normalizeHost(p.Addr) == normalizeHost(host) ||
+			(ip != nil && resolvesTo(p.Addr, ip))) {
+			demoted = append(demoted, peerKey(p.Addr, p.Port))
+			continue
+		}
+		producers = append(producers, *p)
+	}
+
+	d.demoter.startCooldown(append(demoted, peerKey(host, port))...)
+
+	if len(demoted) == 0 {
+		d.log.Infof("failing peer %s is not in the topology of node %s", peerKey(host, port), d.node.Name)
+		return top
+	}
+
+	used := func(n *Node) bool {
+		for i := range producers {
+			if peerKey(producers[i].Addr, producers[i].Port) == peerKey(n.Addr, n.Port) {
+				return true
+			}
+		}
+		return false
+	}
+	for range demoted {
+		spare, ok := d.demoter.nextSpare(used)
+		if !ok {
+			d.log.Warn("no spare peers left to replace demoted peers")
+			break
+		}
+		d.log.Infof("replacing demoted peer with %s:%d", spare.Addr, spare.Port)
+		producers = append(producers, spare)
+	}
+
+	d.log.Warnf("demoted peers %v of node %s", demoted, d.node.Name)
+	top.Producers = producers
+	return top
+}
+
+// dropDemoted removes from top the discovered peers that are in cooldown,
+// they may have been demoted while top was being built.
+func (d *Downloader) dropDemoted(top Topology) Topology {
+	producers := make(NodeList, 0, len(top.Producers))
+	for i := range top.Producers {
+		p := &top.Producers[i]
+		if !p.Internal && !d.isProtected(p) && d.demoter.inCooldown(p) {
+			d.log.Infof("skipping peer %s:%d, it was demoted recently", p.Addr, p.Port)
+			continue
+		}
+		producers = append(producers, *p)
+	}
+	top.Producers = producers
+	return top
+}
@@ -0,0 +1,80 @@
+package cardanocfg_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+)
+
+const demotionConfig = `
+relays:
+  - pool: "test"
+    host: "relay.example.com"
+    network: "mainnet"
+    peers: 3
+    root_dir: %s
+    demotion:
+      threshold: 2
+      cooldown: 1h
+`
+
+func TestPeerFailed(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	c := newTestConfig(t, fmt.Sprintf(demotionConfig, dir))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	selected, err := d.SelectDiverse(testCandidates(), 3)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	filePath, err := d.GetFilePath(cardanocfg.TopologyJSON, false)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	b, err := json.Marshal(cardanocfg.Topology{Producers: selected})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	if !a.Nil(ioutil.WriteFile(filePath, b, 0o600)) {
+		t.FailNow()
+	}
+
+	readAddrs := func() []string {
+		top := cardanocfg.Topology{}
+		b, er := ioutil.ReadFile(filePath)
+		if !a.Nil(er) || !a.Nil(json.Unmarshal(b, &top)) {
+			t.FailNow()
+		}
+		addrs := make([]string, len(top.Producers))
+		for i := range top.Producers {
+			addrs[i] = top.Producers[i].Addr
+		}
+		return addrs
+	}
+
+	d.PeerFailed("10.1.0.2:3001")
+	a.Equal([]string{"10.1.0.1", "10.1.0.2", "10.1.0.3"}, readAddrs())
+
+	d.PeerFailed("10.1.0.2:3001")
+	a.Equal([]string{"10.1.0.1", "10.1.0.3", "10.2.0.1"}, readAddrs())
+
+	// a demoted peer is in cooldown and is not selected again
+	selected, err = d.SelectDiverse(testCandidates(), 3)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	for i := range selected {
+		a.NotEqual("10.1.0.2", selected[i].Addr)
+	}
+}
@@ -0,0 +1,259 @@
+package cardanocfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/geoip"
+)
+
+// Composition summarizes where the selected external peers are located.
+type Composition struct {
+	Peers      int              `json:"peers"`
+	Unknown    int              `json:"unknown"`
+	ASNs       map[uint]int     `json:"asns"`
+	Countries  map[string]int   `json:"countries"`
+	Continents map[string]int   `json:"continents"`
+	Rules      config.Diversity `json:"rules"`
+}
+
+func newComposition(rules config.Diversity) Composition {
+	return Composition{
+		ASNs:       make(map[uint]int),
+		Countries:  make(map[string]int),
+		Continents: make(map[string]int),
+		Rules:      rules,
+	}
+}
+
+func (c *Composition) add(n *Node) {
+	c.Peers++
+	if n.Geo.ASN == 0 {
+		c.Unknown++
+		return
+	}
+	c.ASNs[n.Geo.ASN]++
+	c.Countries[n.Geo.Country]++
+	if n.Geo.Continent != "" {
+		c.Continents[n.Geo.Continent]++
+	}
+}
+
+func (c *Composition) remove(n *Node) {
+	c.Peers--
+	if n.Geo.ASN == 0 {
+		c.Unknown--
+		return
+	}
+	decrement := func(m map[string]int, k string) {
+		if m[k]--; m[k] <= 0 {
+			delete(m, k)
+		}
+	}
+	if c.ASNs[n.Geo.ASN]--; c.ASNs[n.Geo.ASN] <= 0 {
+		delete(c.ASNs, n.Geo.ASN)
+	}
+	decrement(c.Countries, n.Geo.Country)
+	if n.Geo.Continent != "" {
+		decrement(c.Continents, n.Geo.Continent)
+	}
+}
+
+// fits reports whether n can be added without breaking the per ASN and per
+// country limits. Peers with unknown location are not limited.
+func (c *Composition) fits(n *Node) bool {
+	if n.Geo.ASN == 0 {
+		return true
+	}
+	if c.Rules.MaxPerASN > 0 && uint(c.ASNs[n.Geo.ASN]) >= c.Rules.MaxPerASN {
+		return false
+	}
+	if c.Rules.MaxPerCountry > 0 && uint(c.Countries[n.Geo.Country]) >= c.Rules.MaxPerCountry {
+		return false
+	}
+	return true
+}
+
+func (c Composition) String() string {
+	asns := make([]string, 0, len(c.ASNs))
+	for asn, count := range c.ASNs {
+		asns = append(asns, fmt.Sprintf("AS%d:%d", asn, count))
+	}
+	countries := make([]string, 0, len(c.Countries))
+	for country, count := range c.Countries {
+		countries = append(countries, fmt.Sprintf("%s:%d", country, count))
+	}
+	continents := make([]string, 0, len(c.Continents))
+	for continent, count := range c.Continents {
+		continents = append(continents, fmt.Sprintf("%s:%d", continent, count))
+	}
+	sort.Strings(asns)
+	sort.Strings(countries)
+	sort.Strings(continents)
+	return fmt.Sprintf("peers: %d unknown: %d asns: [%s] countries: [%s] continents: [%s]",
+		c.Peers, c.Unknown,
+		strings.Join(asns, " "),
+		strings.Join(countries, " "),
+		strings.Join(continents, " "))
+}
+
+// Composition returns a copy of the composition of the last external peer
+// selection.
+func (d *Downloader) Composition() Composition {
+	d.compositionMu.Lock()
+	defer d.compositionMu.Unlock()
+	return d.composition.copy()
+}
+
+func (c Composition) copy() Composition {
+	cp := c
+	cp.ASNs = make(map[uint]int, len(c.ASNs))
+	for k, v := range c.ASNs {
+		cp.ASNs[k] = v
+	}
+	cp.Countries = make(map[string]int, len(c.Countries))
+	for k, v := range c.Countries {
+		cp.Countries[k] = v
+	}
+	cp.Continents = make(map[string]int, len(c.Continents))
+	for k, v := range c.Continents {
+		cp.Continents[k] = v
+	}
+	return cp
+}
+
+func (d *Downloader) geoDB() (*geoip.DB, error) {
+	d.geoOnce.Do(func() {
+		if d.conf.GeoIPDB == "" {
+			return
+		}
+		d.geo, d.geoErr = geoip.Open(d.conf.GeoIPDB)
+		if d.geoErr == nil {
+			d.log.Infof("loaded geoip db %s with %d ranges", d.conf.GeoIPDB, d.geo.Len())
+		}
+	})
+	return d.geo, d.geoErr
+}
+
+// SetGeo annotates the relays with the location found in the GeoIP/ASN db,
+// if one is configured.
+func (d *Downloader) SetGeo(relays NodeList) (NodeList, error) {
+	db, err := d.geoDB()
+	if err != nil || db == nil {
+		return relays, err
+	}
+	for i := range relays {
+		if info, ok := db.LookupHost(relays[i].Addr); ok {
+			relays[i].Geo = info
+		}
+	}
+	return relays, nil
+}
+
+// SelectDiverse picks up to max relays from candidates preferring lower
+// latency, and shorter paths among the traced ones, while honoring the
+// node's diversity rules: no more than max_per_asn peers in the same ASN,
+// no more than max_per_country in the same country and, when possible,
+// peers in at least min_continents continents.
+func (d *Downloader) SelectDiverse(candidates NodeList, max int) (NodeList, error) {
+	rules := d.node.Diversity
+	candidates = d.excludeCooldown(candidates)
+	sort.Stable(candidates)
+	candidates = preferShortPaths(candidates)
+
+	var err error
+	if candidates, err = d.SetGeo(candidates); err != nil {
+		d.log.Errorf("diversity rules will not be applied: %s", err.Error())
+		rules = config.Diversity{}
+	}
+
+	selected, comp := selectDiverse(candidates, max, rules)
+	d.demoter.setSpares(spares(candidates, selected))
+	if rules.MinContinents > 0 && uint(len(comp.Continents)) < rules.MinContinents {
+		d.log.Warnf("could only select peers in %d continents, %d requested",
+			len(comp.Continents), rules.MinContinents)
+	}
+
+	d.compositionMu.Lock()
+	d.composition = comp
+	d.compositionMu.Unlock()
+	d.log.Infof("node %s peer composition: %s", d.node.Name, comp.String())
+	return selected, nil
+}
+
+func selectDiverse(candidates NodeList, max int, rules config.Diversity) (NodeList, Composition) {
+	comp := newComposition(rules)
+	selected := make(NodeList, 0, max)
+	used := make([]bool, len(candidates))
+
+	for i := range candidates {
+		if len(selected) >= max {
+			break
+		}
+		if !comp.fits(&candidates[i]) {
+			continue
+		}
+		used[i] = true
+		comp.add(&candidates[i])
+		selected = append(selected, candidates[i])
+	}
+
+	// bring in peers from missing continents, each one replacing the
+	// slowest selected peer whose continent is represented more than once.
+	for i := range candidates {
+		if uint(len(comp.Continents)) >= rules.MinContinents {
+			break
+		}
+		c := &candidates[i]
+		if used[i] || c.Geo.Continent == "" || comp.Continents[c.Geo.Continent] > 0 {
+			continue
+		}
+
+		if len(selected) < max {
+			if comp.fits(c) {
+				used[i] = true
+				comp.add(c)
+				selected = append(selected, *c)
+			}
+			continue
+		}
+
+		for j := len(selected) - 1; j >= 0; j-- {
+			victim := selected[j]
+			if victim.Geo.Continent != "" && comp.Continents[victim.Geo.Continent] < 2 {
+				continue
+			}
+			comp.remove(&victim)
+			if !comp.fits(c) {
+				comp.add(&victim)
+				continue
+			}
+			used[i] = true
+			comp.add(c)
+			selected = append(selected[:j], selected[j+1:]...)
+			selected = append(selected, *c)
+			break
+		}
+	}
+
+	sort.Stable(selected)
+	return selected, comp
+}
+
+// spares returns the candidates that were not selected, in the candidates
+// order.
+func spares(candidates, selected NodeList) NodeList {
+	chosen := make(map[string]bool, len(selected))
+	for i := range selected {
+		chosen[peerKey(selected[i].Addr, selected[i].Port)] = true
+	}
+	s := make(NodeList, 0, len(candidates))
+	for i := range candidates {
+		if !chosen[peerKey(candidates[i].Addr, candidates[i].Port)] {
+			s = append(s, candidates[i])
+		}
+	}
+	return s
+}
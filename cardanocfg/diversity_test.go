@@ -0,0 +1,139 @@
+package cardanocfg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/config"
+)
+
+const diversityGeoDB = `10.1.0.0	10.1.255.255	100	US	AS-ONE
+10.2.0.0	10.2.255.255	200	US	AS-TWO
+10.3.0.0	10.3.255.255	300	DE	AS-THREE
+10.4.0.0	10.4.255.255	400	JP	AS-FOUR
+`
+
+const diversityConfig = `
+geoip_db: %s
+relays:
+  - pool: "test"
+    host: "relay.example.com"
+    network: "mainnet"
+    peers: %d
+    root_dir: %s
+    diversity:
+      max_per_asn: %d
+      max_per_country: %d
+      min_continents: %d
+`
+
+func newTestConfig(t *testing.T, yaml string) *config.C {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gocnode.yaml")
+	if err := ioutil.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.New(path, true, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testCandidates() cardanocfg.NodeList {
+	addrs := []string{
+		"10.1.0.1", "10.1.0.2", "10.1.0.3",
+		"10.2.0.1", "10.2.0.2",
+		"10.3.0.1",
+		"10.4.0.1",
+	}
+	nodes := make(cardanocfg.NodeList, len(addrs))
+	for i, addr := range addrs {
+		nodes[i].Addr = addr
+		nodes[i].Port = 3001
+		nodes[i].SetLatency(time.Duration(i+1) * time.Millisecond)
+	}
+	return nodes
+}
+
+func TestSelectDiverse(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	geoPath := filepath.Join(dir, "ip2asn.tsv")
+	if !a.Nil(ioutil.WriteFile(geoPath, []byte(diversityGeoDB), 0o600)) {
+		t.FailNow()
+	}
+
+	c := newTestConfig(t, fmt.Sprintf(diversityConfig, geoPath, 4, dir, 1, 0, 3))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	selected, err := d.SelectDiverse(testCandidates(), 4)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	addrs := make([]string, len(selected))
+	for i := range selected {
+		addrs[i] = selected[i].Addr
+	}
+	a.Equal([]string{"10.1.0.1", "10.2.0.1", "10.3.0.1", "10.4.0.1"}, addrs)
+
+	comp := d.Composition()
+	a.Equal(4, comp.Peers)
+	a.Len(comp.Continents, 3)
+	a.Equal(2, comp.Countries["US"])
+
+	// the composition is read while new selections are made
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			_, _ = d.SelectDiverse(testCandidates(), 4)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		comp = d.Composition()
+		comp.Countries["US"]++
+	}
+	<-done
+	a.Equal(2, d.Composition().Countries["US"])
+}
+
+func TestSelectDiverseMinContinents(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	geoPath := filepath.Join(dir, "ip2asn.tsv")
+	if !a.Nil(ioutil.WriteFile(geoPath, []byte(diversityGeoDB), 0o600)) {
+		t.FailNow()
+	}
+
+	c := newTestConfig(t, fmt.Sprintf(diversityConfig, geoPath, 3, dir, 0, 0, 3))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	selected, err := d.SelectDiverse(testCandidates(), 3)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	// the fastest peer is kept, the two slowest US peers make room for
+	// a peer in Europe and a peer in Asia.
+	addrs := make([]string, len(selected))
+	for i := range selected {
+		addrs[i] = selected[i].Addr
+	}
+	a.Equal([]string{"10.1.0.1", "10.3.0.1", "10.4.0.1"}, addrs)
+}
@@ -0,0 +1,192 @@
+package cardanocfg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+// DownloadErrors aggregates the errors of a set of downloads.
+type DownloadErrors []error
+
+func (e DownloadErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return fmt.Sprintf("%d download errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// errorOrNil returns nil for an empty DownloadErrors so it can be returned
+// as error.
+func (e DownloadErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// statusError is returned for non 2xx responses, retry tells whether the
+// request is worth repeating.
+type statusError struct {
+	url    string
+	status string
+	retry  bool
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.url, e.status)
+}
+
+// NewHTTPClient builds the http client used for downloads from the http
+// settings: timeout, proxy (the environment is used when empty) and an
+// optional CA file added to the system pool.
+func NewHTTPClient(c config.HTTP) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, errors.Annotatef(err, "bad http proxy: %s", c.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading CA file: %s", c.CAFile)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA file: %s", c.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{Timeout: c.Timeout, Transport: transport}, nil
+}
+
+// checkContentType rejects responses that are clearly not the json files we
+// download, mainly html error pages served with a 200 status.
+func checkContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errors.Annotatef(err, "bad content type: %s", contentType)
+	}
+	switch {
+	case strings.Contains(mediaType, "json"),
+		mediaType == "text/plain",
+		mediaType == "application/octet-stream":
+		return nil
+	}
+	return errors.Errorf("unexpected content type: %s", mediaType)
+}
+
+// DownloadFile will download a url to a local file. It's efficient because it will
+// write as it downloads and not load the whole file into memory. The file is
+// written to a temporary file first and renamed once complete. Failed
+// requests are retried with exponential backoff.
+func (d *Downloader) DownloadFile(ctx context.Context, filePath, url string) error {
+	backoff := d.conf.HTTP.Backoff
+	retries := *d.conf.HTTP.Retries
+	var err error
+	for attempt := uint(0); attempt <= retries; attempt++ {
+		if attempt > 0 {
+			d.log.Warnf("retrying download of %s in %v: %s", url, backoff, err.Error())
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return errors.Annotatef(ctx.Err(), "downloading %s", url)
+			}
+			backoff *= 2
+		}
+
+		err = d.downloadFile(ctx, filePath, url)
+		if err == nil {
+			return nil
+		}
+		if se, ok := err.(statusError); ok && !se.retry {
+			return err
+		}
+		if ctx.Err() != nil {
+			return errors.Annotatef(ctx.Err(), "downloading %s", url)
+		}
+	}
+	return errors.Annotatef(err, "giving up after %d attempts", retries+1)
+}
+
+func (d *Downloader) downloadFile(ctx context.Context, filePath, url string) error {
+	d.log.Info("downloading from URL: ", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	// Get the data
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError{
+			url:    url,
+			status: resp.Status,
+			retry:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
+	}
+	if err = checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return statusError{url: url, status: err.Error()}
+	}
+
+	// Create the file
+	dir := filepath.Dir(filePath)
+	if er := os.MkdirAll(dir, os.ModePerm); er != nil {
+		return er
+	}
+	out, err := ioutil.TempFile(dir, "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// Write the body to file
+	_, err = io.Copy(out, resp.Body)
+	if er := out.Close(); err == nil {
+		err = er
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), filePath)
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+
+	d.log.Info("saved to file: ", filePath)
+	return nil
+}
@@ -0,0 +1,104 @@
+package cardanocfg_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+)
+
+const downloadConfig = `
+http:
+  retries: 2
+  backoff: 1ms
+  timeout: 5s
+relays:
+  - pool: "test"
+    host: "relay.example.com"
+    network: "mainnet"
+    root_dir: %s
+`
+
+func TestDownloadFile(t *testing.T) {
+	a := assert.New(t)
+
+	var flaky int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"networkMagic": 42}`)
+	})
+	mux.HandleFunc("/flaky.json", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flaky, 1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/page.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html></html>`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := newTestConfig(t, fmt.Sprintf(downloadConfig, dir))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	ctx := context.Background()
+
+	path := filepath.Join(dir, "ok.json")
+	if a.Nil(d.DownloadFile(ctx, path, srv.URL+"/ok.json")) {
+		b, er := ioutil.ReadFile(path)
+		a.Nil(er)
+		a.Equal(`{"networkMagic": 42}`, string(b))
+	}
+
+	a.Nil(d.DownloadFile(ctx, filepath.Join(dir, "flaky.json"), srv.URL+"/flaky.json"))
+	a.Equal(int32(3), atomic.LoadInt32(&flaky))
+
+	a.NotNil(d.DownloadFile(ctx, filepath.Join(dir, "missing.json"), srv.URL+"/missing.json"))
+	a.NoFileExists(filepath.Join(dir, "missing.json"))
+
+	a.NotNil(d.DownloadFile(ctx, filepath.Join(dir, "page.json"), srv.URL+"/page.json"))
+	a.NoFileExists(filepath.Join(dir, "page.json"))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	a.NotNil(d.DownloadFile(cancelled, filepath.Join(dir, "cancelled.json"), srv.URL+"/ok.json"))
+}
+
+func TestDownloadFileNoRetries(t *testing.T) {
+	a := assert.New(t)
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := newTestConfig(t, fmt.Sprintf(strings.Replace(downloadConfig, "retries: 2", "retries: 0", 1), dir))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	// a configured 0 disables the retries
+	a.NotNil(d.DownloadFile(context.Background(), filepath.Join(dir, "busy.json"), srv.URL+"/busy.json"))
+	a.Equal(int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,64 @@
+package cardanocfg
+
+import (
+	"net"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+// pingNetwork returns the go-ping network matching the node's IP family.
+func (d *Downloader) pingNetwork() string {
+	switch d.node.IPFamily {
+	case config.IPv6:
+		return "ip6"
+	case config.DualStack:
+		return "ip"
+	default:
+		return "ip4"
+	}
+}
+
+// familyIPs returns the addresses of host that belong to the node's IP
+// families, host can be an IP literal or a name to resolve.
+func (d *Downloader) familyIPs(host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return nil, err
+		}
+	}
+
+	allowed := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if d.node.AllowsIP(ip) {
+			allowed = append(allowed, ip)
+		}
+	}
+	return allowed, nil
+}
+
+// FilterFamily removes the peers that can not be reached with the node's IP
+// family: IP literals of the other family and names without an address of
+// the node's family. Names that fail to resolve are kept.
+func (d *Downloader) FilterFamily(nodes NodeList) NodeList {
+	if d.node.IPFamily == config.DualStack {
+		return nodes
+	}
+
+	filtered := make(NodeList, 0, len(nodes))
+	for i := range nodes {
+		ips, err := d.familyIPs(nodes[i].Addr)
+		if err == nil && len(ips) == 0 {
+			d.log.Debugf("peer %s has no %s address", nodes[i].Addr, d.node.IPFamily)
+			continue
+		}
+		filtered = append(filtered, nodes[i])
+	}
+	if dropped := len(nodes) - len(filtered); dropped > 0 {
+		d.log.Infof("dropped %d peers without %s addresses", dropped, d.node.IPFamily)
+	}
+	return filtered
+}
@@ -0,0 +1,65 @@
+package cardanocfg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/config"
+)
+
+const ipFamilyConfig = `
+relays:
+  - pool: "test"
+    host: "relay.example.com"
+    network: "mainnet"
+    peers: 3
+    root_dir: %s
+    ip_family: %s
+`
+
+func TestFilterFamily(t *testing.T) {
+	a := assert.New(t)
+
+	nodes := cardanocfg.NodeList{
+		{Addr: "192.0.2.1", Port: 3001},
+		{Addr: "2001:db8::1", Port: 3001},
+		{Addr: "198.51.100.1", Port: 3001},
+	}
+
+	for family, expected := range map[string][]string{
+		config.IPv4:      {"192.0.2.1", "198.51.100.1"},
+		config.IPv6:      {"2001:db8::1"},
+		config.DualStack: {"192.0.2.1", "2001:db8::1", "198.51.100.1"},
+	} {
+		c := newTestConfig(t, fmt.Sprintf(ipFamilyConfig, t.TempDir(), family))
+		d, err := cardanocfg.New(&c.Relays[0], c)
+		if !a.Nil(err) {
+			t.FailNow()
+		}
+
+		filtered := d.FilterFamily(append(cardanocfg.NodeList{}, nodes...))
+		addrs := make([]string, len(filtered))
+		for i := range filtered {
+			addrs[i] = filtered[i].Addr
+		}
+		a.Equal(expected, addrs, family)
+	}
+}
+
+func TestBadIPFamily(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "gocnode.yaml")
+	yaml := fmt.Sprintf(ipFamilyConfig, t.TempDir(), "ipv5")
+	if !a.Nil(ioutil.WriteFile(path, []byte(yaml), 0o600)) {
+		t.FailNow()
+	}
+
+	_, err := config.New(path, true, "debug")
+	a.NotNil(err)
+}
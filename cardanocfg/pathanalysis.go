@@ -0,0 +1,117 @@
+package cardanocfg
+
+import (
+	"context"
+	"sort"
+
+	"github.com/adakailabs/gocnode/pathtrace"
+)
+
+func (d *Downloader) newTracer() *pathtrace.Tracer {
+	geo, err := d.geoDB()
+	if err != nil {
+		d.log.Warnf("AS paths will not be reported: %s", err.Error())
+	}
+	return pathtrace.New(pathtrace.Config{
+		MaxHops: int(d.node.PathAnalysis.MaxHops),
+		Timeout: d.node.PathAnalysis.Timeout,
+		Count:   2,
+	}, geo)
+}
+
+// TracePeer traces the route to host.
+func (d *Downloader) TracePeer(ctx context.Context, host string) (*pathtrace.Path, error) {
+	tracer := d.newTracer()
+	defer tracer.Close()
+	return tracer.TraceHost(ctx, host)
+}
+
+// AnalyzePaths traces the route to the path_analysis.candidates lowest
+// latency candidates and records it in their Path. It does nothing unless
+// path analysis is enabled.
+func (d *Downloader) AnalyzePaths(ctx context.Context, candidates NodeList) NodeList {
+	if !d.node.PathAnalysis.Enabled || len(candidates) == 0 {
+		return candidates
+	}
+	sort.Stable(candidates)
+
+	n := int(d.node.PathAnalysis.Candidates)
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+
+	tracer := d.newTracer()
+	defer tracer.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, d.node.Probe.Deadline)
+	defer cancel()
+
+	errs := make([]error, n)
+	d.newProber("path analysis").Run(ctx, n, func(ctx context.Context, i int) {
+		c := &candidates[i]
+		path, err := tracer.TraceHost(ctx, c.Addr)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		c.Path = path
+		d.log.Infof("relay %s path: %s", c.Addr, path.String())
+	})
+
+	failed := 0
+	for i := range errs {
+		if errs[i] != nil {
+			failed++
+			d.log.Debugf("could not trace %s: %s", candidates[i].Addr, errs[i].Error())
+		}
+	}
+	if failed > 0 && failed == n {
+		d.log.Warnf("path analysis failed for every candidate, last error: %s", errs[n-1].Error())
+	}
+	return candidates
+}
+
+// preferShortPaths reorders the traced candidates, keeping the positions
+// they hold in the list: peers that answered the trace come first, by
+// number of hops, and peers behind a transit already used are moved after
+// the ones reached through other networks.
+func preferShortPaths(candidates NodeList) NodeList {
+	positions := make([]int, 0)
+	traced := make(NodeList, 0)
+	for i := range candidates {
+		if candidates[i].Path != nil {
+			positions = append(positions, i)
+			traced = append(traced, candidates[i])
+		}
+	}
+	if len(traced) < 2 {
+		return candidates
+	}
+
+	sort.SliceStable(traced, func(i, j int) bool {
+		pi, pj := traced[i].Path, traced[j].Path
+		if pi.Reached != pj.Reached {
+			return pi.Reached
+		}
+		return pi.HopCount < pj.HopCount
+	})
+
+	ordered := make(NodeList, 0, len(traced))
+	repeated := make(NodeList, 0)
+	transits := make(map[string]bool)
+	for _, c := range traced {
+		transit := c.Path.Transit()
+		if transit != "" && transits[transit] {
+			repeated = append(repeated, c)
+			continue
+		}
+		transits[transit] = true
+		ordered = append(ordered, c)
+	}
+	ordered = append(ordered, repeated...)
+
+	for i, pos := range positions {
+		candidates[pos] = ordered[i]
+	}
+	return candidates
+}
@@ -0,0 +1,42 @@
+package cardanocfg_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/pathtrace"
+)
+
+func TestSelectDiversePrefersShortPaths(t *testing.T) {
+	a := assert.New(t)
+
+	c := newTestConfig(t, fmt.Sprintf(pipelineConfig, "http://localhost", t.TempDir()))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	candidates := testCandidates()
+	// 10.1.0.1 and 10.1.0.2 are the fastest but far away, 10.1.0.3 is not
+	// reachable and 10.2.0.1 shares its transit with 10.2.0.2
+	candidates[0].Path = &pathtrace.Path{Reached: true, HopCount: 12, ASPath: []uint{1, 100}}
+	candidates[1].Path = &pathtrace.Path{Reached: true, HopCount: 11, ASPath: []uint{2, 100}}
+	candidates[2].Path = &pathtrace.Path{Reached: false, HopCount: 3}
+	candidates[3].Path = &pathtrace.Path{Reached: true, HopCount: 5, ASPath: []uint{3, 200}}
+	candidates[4].Path = &pathtrace.Path{Reached: true, HopCount: 6, ASPath: []uint{3, 200}}
+
+	selected, err := d.SelectDiverse(candidates, 3)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	addrs := make([]string, len(selected))
+	for i := range selected {
+		addrs[i] = selected[i].Addr
+	}
+	// the selection is still reported by latency
+	a.Equal([]string{"10.1.0.1", "10.1.0.2", "10.2.0.1"}, addrs)
+}
@@ -0,0 +1,264 @@
+package cardanocfg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// peerFile is the content of a curated peers file, either in the legacy
+// topology format or in the P2P one.
+type peerFile struct {
+	Producers   []peerFileNode `json:"Producers" yaml:"Producers"`
+	LocalRoots  []peerFileRoot `json:"localRoots" yaml:"localRoots"`
+	PublicRoots []peerFileRoot `json:"publicRoots" yaml:"publicRoots"`
+}
+
+type peerFileNode struct {
+	Addr    string `json:"addr" yaml:"addr"`
+	Port    uint   `json:"port" yaml:"port"`
+	Valency uint   `json:"valency" yaml:"valency"`
+}
+
+type peerFileRoot struct {
+	AccessPoints []peerFileAccessPoint `json:"accessPoints" yaml:"accessPoints"`
+	Advertise    bool                  `json:"advertise" yaml:"advertise"`
+	Valency      uint                  `json:"valency" yaml:"valency"`
+}
+
+type peerFileAccessPoint struct {
+	Address string `json:"address" yaml:"address"`
+	Port    uint   `json:"port" yaml:"port"`
+}
+
+// LoadPeerFile reads a curated peers file. Files ending in .json are read
+// as JSON, any other file as YAML. Both the legacy format:
+//
+//	{"Producers": [{"addr": "relay.example.com", "port": 3001, "valency": 2}]}
+//
+// and the P2P one are accepted:
+//
+//	{"localRoots": [{"accessPoints": [{"address": "relay.example.com", "port": 3001}], "valency": 2}],
+//	 "publicRoots": [{"accessPoints": [{"address": "relay.example.org", "port": 3001}]}]}
+//
+// A P2P group with a single access point keeps the group valency, the
+// access points of larger groups get valency 1. Unknown fields, missing
+// addresses, invalid ports and zero valencies are errors.
+func LoadPeerFile(path string) (NodeList, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pf := peerFile{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&pf)
+	} else {
+		err = yaml.UnmarshalStrict(b, &pf)
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing peers file %s", path)
+	}
+
+	nodes := make(NodeList, 0, len(pf.Producers))
+	for i, p := range pf.Producers {
+		if p.Valency == 0 {
+			return nil, fmt.Errorf("peers file %s: Producers[%d]: valency must be at least 1", path, i)
+		}
+		nodes = append(nodes, Node{Addr: p.Addr, Port: p.Port, Valency: p.Valency})
+	}
+	roots := map[string][]peerFileRoot{"localRoots": pf.LocalRoots, "publicRoots": pf.PublicRoots}
+	for _, name := range []string{"localRoots", "publicRoots"} {
+		for i, r := range roots[name] {
+			if len(r.AccessPoints) == 0 {
+				return nil, fmt.Errorf("peers file %s: %s[%d]: no access points", path, name, i)
+			}
+			valency := uint(1)
+			if len(r.AccessPoints) == 1 && r.Valency > 0 {
+				valency = r.Valency
+			}
+			for _, ap := range r.AccessPoints {
+				nodes = append(nodes, Node{Addr: ap.Address, Port: ap.Port, Valency: valency})
+			}
+		}
+	}
+
+	for i := range nodes {
+		n := &nodes[i]
+		if strings.TrimSpace(n.Addr) == "" {
+			return nil, fmt.Errorf("peers file %s: entry %d: missing address", path, i)
+		}
+		if n.Port == 0 || n.Port > 65535 {
+			return nil, fmt.Errorf("peers file %s: entry %d (%s): invalid port %d", path, i, n.Addr, n.Port)
+		}
+		n.Atype = regularRelay
+		n.Internal = true
+	}
+	return nodes, nil
+}
+
+// CuratedPeers loads the node's peer_files, in order, dropping the entries
+// already listed by a previous file.
+func (d *Downloader) CuratedPeers() (NodeList, error) {
+	curated := make(NodeList, 0)
+	seen := make(map[string]bool)
+	for _, path := range d.node.PeerFiles {
+		nodes, err := LoadPeerFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			key := peerKey(normalizeHost(n.Addr), n.Port)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			curated = append(curated, n)
+		}
+	}
+
+	d.curatedMu.Lock()
+	d.curated = seen
+	d.curatedMu.Unlock()
+	return curated, nil
+}
+
+// isCurated reports whether n was loaded from the peer files.
+func (d *Downloader) isCurated(n *Node) bool {
+	d.curatedMu.Lock()
+	defer d.curatedMu.Unlock()
+	return d.curated[peerKey(normalizeHost(n.Addr), n.Port)]
+}
+
+// mergeCurated puts the curated peers in front of the other peers of top,
+// replacing the entries they duplicate.
+func (d *Downloader) mergeCurated(top Topology, curated NodeList) Topology {
+	keys := make(map[string]bool, len(curated))
+	for _, n := range curated {
+		keys[peerKey(normalizeHost(n.Addr), n.Port)] = true
+	}
+	merged := Topology{Producers: append(make([]Node, 0, len(curated)+len(top.Producers)), curated...)}
+	for _, p := range top.Producers {
+		if !keys[peerKey(normalizeHost(p.Addr), p.Port)] {
+			merged.Producers = append(merged.Producers, p)
+		}
+	}
+	return merged
+}
+
+// WatchPeerFiles polls the node's peer_files every peer_files_interval and,
+// when one of them changes, replaces the curated peers of the topology file
+// with the new ones. Files that fail to validate are reported and the
+// topology is left untouched. WatchPeerFiles returns when ctx is done.
+func (d *Downloader) WatchPeerFiles(ctx context.Context) {
+	if len(d.node.PeerFiles) == 0 {
+		return
+	}
+	ticker := time.NewTicker(d.node.PeerFilesInterval)
+	defer ticker.Stop()
+
+	last := peerFilesModTime(d.node.PeerFiles)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mtimes := peerFilesModTime(d.node.PeerFiles)
+		if mtimes == last {
+			continue
+		}
+		last = mtimes
+		d.log.Infof("peer files changed, updating topology")
+		if err := d.applyPeerFiles(); err != nil {
+			d.log.Errorf("peer files not applied: %s", err.Error())
+		}
+	}
+}
+
+// peerFilesModTime returns a fingerprint of the modification times and
+// sizes of files, missing files are part of it.
+func peerFilesModTime(files []string) string {
+	var sb strings.Builder
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			sb.WriteString("missing;")
+			continue
+		}
+		fmt.Fprintf(&sb, "%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+	return sb.String()
+}
+
+// applyPeerFiles reloads the peer files and replaces the previously curated
+// peers of the node's topology file with them.
+func (d *Downloader) applyPeerFiles() error {
+	filePath, err := d.GetFilePath(TopologyJSON, false)
+	if err != nil {
+		return err
+	}
+	return d.updateTopology(filePath, func(top Topology) (Topology, error) {
+		d.curatedMu.Lock()
+		previous := d.curated
+		d.curatedMu.Unlock()
+
+		curated, err := d.CuratedPeers()
+		if err != nil {
+			return top, err
+		}
+
+		// Internal is not stored in the file, it is restored for the pool's
+		// own nodes and the pinned peers, the discovered peers are checked
+		// again like on the next discovery
+		internal := d.internalKeys()
+		others := Topology{Producers: make([]Node, 0, len(top.Producers))}
+		for _, p := range top.Producers {
+			if previous[peerKey(normalizeHost(p.Addr), p.Port)] {
+				continue
+			}
+			p.Internal = internal[peerKey(p.Addr, p.Port)]
+			others.Producers = append(others.Producers, p)
+		}
+
+		return d.SanitizeTopology(d.mergeCurated(others, curated)), nil
+	})
+}
+
+// internalKeys returns the keys of the peers discoverTopology marks
+// Internal: the pinned peers and the pool's own nodes.
+func (d *Downloader) internalKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, p := range d.filter.Pinned() {
+		keys[peerKey(p.Addr, p.Port)] = true
+	}
+	if d.node.IsProducer {
+		for _, r := range d.node.Relays {
+			keys[peerKey(r.Host, r.Port)] = true
+		}
+		return keys
+	}
+	if !d.node.TopologyPolicy.OmitInternal {
+		for _, p := range d.node.ExtProducer {
+			keys[peerKey(p.Host, p.Port)] = true
+		}
+		for _, p := range d.conf.Producers {
+			if p.Pool == d.node.Pool {
+				keys[peerKey(p.Host, p.Port)] = true
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,243 @@
+package cardanocfg_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+)
+
+const legacyPeerFile = `{
+  "Producers": [
+    {"addr": "1.1.1.1", "port": 3001, "valency": 1},
+    {"addr": "friend.example.com", "port": 6000, "valency": 2}
+  ]
+}`
+
+const p2pPeerFile = `
+localRoots:
+  - accessPoints:
+      - address: 2.2.2.2
+        port: 3001
+    advertise: false
+    valency: 3
+  - accessPoints:
+      - address: 3.3.3.3
+        port: 3001
+      - address: 1.1.1.1
+        port: 3001
+    valency: 2
+publicRoots:
+  - accessPoints:
+      - address: 4.4.4.4
+        port: 3002
+`
+
+const peerFilesConfig = `
+producers:
+  - pool: "test"
+    host: "producer.example.com"
+    network: "mainnet"
+    root_dir: %s
+    peer_files: [%s, %s]
+    peer_files_interval: 10ms
+relays:
+  - pool: "test"
+    host: "relay0.example.com"
+    network: "mainnet"
+    port: 3001
+`
+
+func writePeerFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func peerAddrs(nodes []cardanocfg.Node) []string {
+	addrs := make([]string, len(nodes))
+	for i, n := range nodes {
+		addrs[i] = fmt.Sprintf("%s:%d/%d", n.Addr, n.Port, n.Valency)
+	}
+	return addrs
+}
+
+func TestLoadPeerFile(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	nodes, err := cardanocfg.LoadPeerFile(writePeerFile(t, dir, "legacy.json", legacyPeerFile))
+	a.Nil(err)
+	a.Equal([]string{"1.1.1.1:3001/1", "friend.example.com:6000/2"}, peerAddrs(nodes))
+
+	nodes, err = cardanocfg.LoadPeerFile(writePeerFile(t, dir, "p2p.yaml", p2pPeerFile))
+	a.Nil(err)
+	a.Equal([]string{"2.2.2.2:3001/3", "3.3.3.3:3001/1", "1.1.1.1:3001/1", "4.4.4.4:3002/1"}, peerAddrs(nodes))
+
+	invalid := map[string]string{
+		"unknown.json": `{"Producers": [{"addr": "1.1.1.1", "port": 3001, "valency": 1, "foo": 1}]}`,
+		"port.json":    `{"Producers": [{"addr": "1.1.1.1", "port": 0, "valency": 1}]}`,
+		"valency.yaml": "Producers:\n  - addr: 1.1.1.1\n    port: 3001\n",
+		"addr.yaml":    "publicRoots:\n  - accessPoints:\n      - port: 3001\n",
+		"empty.yaml":   "localRoots:\n  - valency: 1\n",
+		"syntax.json":  `{"Producers": [`,
+	}
+	for name, content := range invalid {
+		_, err = cardanocfg.LoadPeerFile(writePeerFile(t, dir, name, content))
+		a.NotNil(err, name)
+	}
+}
+
+func TestPeerFilesMerge(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	legacy := writePeerFile(t, dir, "legacy.json", legacyPeerFile)
+	p2p := writePeerFile(t, dir, "p2p.yaml", p2pPeerFile)
+	c := newTestConfig(t, fmt.Sprintf(peerFilesConfig, dir, legacy, p2p))
+	node := &c.Producers[0]
+	node.IsProducer = true
+	// also listed by the legacy file, the curated entry wins
+	node.Relays = append(node.Relays, node.Relays[0])
+	node.Relays[1].Host = "friend.example.com"
+	node.Relays[1].Port = 6000
+
+	d, err := cardanocfg.New(node, c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	top, err := d.BuildTopology(context.Background())
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal([]string{
+		"1.1.1.1:3001/1", "friend.example.com:6000/2",
+		"2.2.2.2:3001/3", "3.3.3.3:3001/1", "4.4.4.4:3002/1",
+		"relay0.example.com:3001/1",
+	}, peerAddrs(top.Producers))
+
+	// a broken file fails the build instead of being ignored
+	writePeerFile(t, dir, "p2p.yaml", "localRoots: [")
+	_, err = d.BuildTopology(context.Background())
+	a.NotNil(err)
+}
+
+func TestWatchPeerFiles(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	legacy := writePeerFile(t, dir, "legacy.json", legacyPeerFile)
+	p2p := writePeerFile(t, dir, "p2p.yaml", p2pPeerFile)
+	c := newTestConfig(t, fmt.Sprintf(peerFilesConfig, dir, legacy, p2p))
+	node := &c.Producers[0]
+	node.IsProducer = true
+
+	d, err := cardanocfg.New(node, c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	if !a.Nil(d.DownloadAndSetTopologyFile(context.Background())) {
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.WatchPeerFiles(ctx)
+	time.Sleep(time.Millisecond * 30)
+
+	// an invalid file leaves the topology untouched
+	initial := d.LastTopologyDiff()
+	writePeerFile(t, dir, "p2p.yaml", "localRoots: [")
+	time.Sleep(time.Millisecond * 50)
+	a.Equal(initial, d.LastTopologyDiff())
+
+	writePeerFile(t, dir, "p2p.yaml", "publicRoots:\n  - accessPoints:\n      - address: 5.5.5.5\n        port: 3001\n")
+	var diff cardanocfg.TopologyDiff
+	for i := 0; i < 100; i++ {
+		time.Sleep(time.Millisecond * 10)
+		if diff = d.LastTopologyDiff(); len(diff.Removed) > 0 {
+			break
+		}
+	}
+	a.Equal([]string{"5.5.5.5:3001"}, diff.Added)
+	a.ElementsMatch([]string{"2.2.2.2:3001", "3.3.3.3:3001", "4.4.4.4:3002"}, diff.Removed)
+}
+
+const privatePeerFilesConfig = `
+producers:
+  - pool: "test"
+    host: "producer.example.com"
+    network: "mainnet"
+    root_dir: %s
+    peer_files: [%s]
+    peer_files_interval: 10ms
+relays:
+  - pool: "test"
+    host: "10.0.0.1"
+    network: "mainnet"
+    port: 3001
+`
+
+func TestPeerFilesInternal(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	legacy := writePeerFile(t, dir, "legacy.json", legacyPeerFile)
+	c := newTestConfig(t, fmt.Sprintf(privatePeerFilesConfig, dir, legacy))
+	node := &c.Producers[0]
+	node.IsProducer = true
+
+	d, err := cardanocfg.New(node, c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	if !a.Nil(d.DownloadAndSetTopologyFile(context.Background())) {
+		t.FailNow()
+	}
+
+	// a discovered peer with a private address in the topology file
+	filePath, err := d.GetFilePath(cardanocfg.TopologyJSON, false)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	top := cardanocfg.Topology{}
+	b, err := ioutil.ReadFile(filePath)
+	if !a.Nil(err) || !a.Nil(json.Unmarshal(b, &top)) {
+		t.FailNow()
+	}
+	top.Producers = append(top.Producers, cardanocfg.Node{Addr: "10.0.0.2", Port: 3001, Valency: 1})
+	if b, err = json.Marshal(top); !a.Nil(err) {
+		t.FailNow()
+	}
+	if !a.Nil(ioutil.WriteFile(filePath, b, 0o600)) {
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.WatchPeerFiles(ctx)
+	time.Sleep(time.Millisecond * 30)
+
+	// the relay of the pool keeps its private address, the discovered peer
+	// is sanitized again and dropped
+	writePeerFile(t, dir, "legacy.json", `{"Producers": [{"addr": "5.5.5.5", "port": 3001, "valency": 1}]}`)
+	var diff cardanocfg.TopologyDiff
+	for i := 0; i < 100; i++ {
+		time.Sleep(time.Millisecond * 10)
+		if diff = d.LastTopologyDiff(); len(diff.Removed) > 0 {
+			break
+		}
+	}
+	a.Equal([]string{"5.5.5.5:3001"}, diff.Added)
+	a.ElementsMatch([]string{"1.1.1.1:3001", "friend.example.com:6000", "10.0.0.2:3001"}, diff.Removed)
+}
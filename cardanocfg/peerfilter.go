@@ -0,0 +1,184 @@
+package cardanocfg
+
+import (
+	"net"
+	"path"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+type matcher struct {
+	pattern string
+	glob    bool
+	ip      net.IP
+	cidr    *net.IPNet
+}
+
+func newMatcher(pattern string) (matcher, error) {
+	m := matcher{pattern: normalizeHost(pattern)}
+	if m.pattern == "" {
+		return m, errors.Errorf("empty peer pattern")
+	}
+
+	switch {
+	case strings.Contains(m.pattern, "/"):
+		_, cidr, err := net.ParseCIDR(m.pattern)
+		if err != nil {
+			return m, errors.Annotatef(err, "bad peer CIDR: %s", pattern)
+		}
+		m.cidr = cidr
+	case net.ParseIP(m.pattern) != nil:
+		m.ip = net.ParseIP(m.pattern)
+	case strings.ContainsAny(m.pattern, "*?["):
+		if _, err := path.Match(m.pattern, ""); err != nil {
+			return m, errors.Annotatef(err, "bad peer glob: %s", pattern)
+		}
+		m.glob = true
+	}
+	return m, nil
+}
+
+func (m matcher) byAddress() bool {
+	return m.ip != nil || m.cidr != nil
+}
+
+func (m matcher) matchIP(ip net.IP) bool {
+	if m.cidr != nil {
+		return m.cidr.Contains(ip)
+	}
+	return m.ip.Equal(ip)
+}
+
+func (m matcher) matchName(host string) bool {
+	if m.glob {
+		ok, _ := path.Match(m.pattern, host)
+		return ok
+	}
+	return m.pattern == host
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// PeerFilter decides which discovered peers a node may use. It is built from
+// the node's peer_filter settings merged with the network wide
+// peer_filters.
+type PeerFilter struct {
+	allow  []matcher
+	block  []matcher
+	pinned NodeList
+
+	lookupIP func(host string) ([]net.IP, error)
+}
+
+func NewPeerFilter(c config.PeerFilter) (*PeerFilter, error) {
+	f := &PeerFilter{lookupIP: net.LookupIP}
+
+	for _, p := range c.Allow {
+		m, err := newMatcher(p)
+		if err != nil {
+			return f, errors.Annotate(err, "peer allow list")
+		}
+		f.allow = append(f.allow, m)
+	}
+	for _, p := range c.Block {
+		m, err := newMatcher(p)
+		if err != nil {
+			return f, errors.Annotate(err, "peer block list")
+		}
+		f.block = append(f.block, m)
+	}
+	for _, p := range c.Pinned {
+		if p.Host == "" || p.Port == 0 {
+			return f, errors.Errorf("pinned peers need host and port: %v", p)
+		}
+		f.pinned = append(f.pinned, Node{
+			Addr:    p.Host,
+			Port:    p.Port,
+			Atype:   regularRelay,
+			Valency: 1,
+		})
+	}
+	return f, nil
+}
+
+// Pinned returns the peers that must always be part of the topology.
+func (f *PeerFilter) Pinned() NodeList {
+	pinned := make(NodeList, len(f.pinned))
+	copy(pinned, f.pinned)
+	return pinned
+}
+
+func (f *PeerFilter) isPinned(n *Node) bool {
+	for i := range f.pinned {
+		if normalizeHost(f.pinned[i].Addr) == normalizeHost(n.Addr) && f.pinned[i].Port == n.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether host passes the block and allow lists.
+func (f *PeerFilter) Allowed(host string) bool {
+	host = normalizeHost(host)
+
+	var ips []net.IP
+	resolved := false
+	matches := func(list []matcher) bool {
+		for _, m := range list {
+			if !m.byAddress() {
+				if m.matchName(host) {
+					return true
+				}
+				continue
+			}
+			if !resolved {
+				resolved = true
+				if ip := net.ParseIP(host); ip != nil {
+					ips = []net.IP{ip}
+				} else {
+					ips, _ = f.lookupIP(host)
+				}
+			}
+			for _, ip := range ips {
+				if m.matchIP(ip) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if matches(f.block) {
+		return false
+	}
+	if len(f.allow) > 0 && !matches(f.allow) {
+		return false
+	}
+	return true
+}
+
+// Apply removes blocked, not allowed and pinned peers from nodes. Pinned
+// peers are removed so they are not counted twice when the pinned list is
+// added to the topology.
+func (f *PeerFilter) Apply(nodes NodeList) NodeList {
+	if len(f.allow) == 0 && len(f.block) == 0 && len(f.pinned) == 0 {
+		return nodes
+	}
+
+	filtered := make(NodeList, 0, len(nodes))
+	for i := range nodes {
+		if f.isPinned(&nodes[i]) {
+			continue
+		}
+		if !f.Allowed(nodes[i].Addr) {
+			continue
+		}
+		filtered = append(filtered, nodes[i])
+	}
+	return filtered
+}
@@ -0,0 +1,68 @@
+package cardanocfg_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/config"
+)
+
+func TestPeerFilter(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := cardanocfg.NewPeerFilter(config.PeerFilter{
+		Block: []string{"bad.example.com", "*.flaky.net", "203.0.113.0/24", "198.51.100.7"},
+		Pinned: []config.NodeShort{
+			{Host: "friend.example.org", Port: 3001},
+		},
+	})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	a.False(f.Allowed("bad.example.com"))
+	a.False(f.Allowed("BAD.example.com."))
+	a.False(f.Allowed("relay1.flaky.net"))
+	a.False(f.Allowed("203.0.113.45"))
+	a.False(f.Allowed("198.51.100.7"))
+	a.True(f.Allowed("198.51.100.8"))
+	a.True(f.Allowed("good.example.com"))
+
+	nodes := cardanocfg.NodeList{
+		{Addr: "good.example.com", Port: 3001},
+		{Addr: "203.0.113.1", Port: 3001},
+		{Addr: "friend.example.org", Port: 3001},
+	}
+	filtered := f.Apply(nodes)
+	if a.Len(filtered, 1) {
+		a.Equal("good.example.com", filtered[0].Addr)
+	}
+
+	pinned := f.Pinned()
+	if a.Len(pinned, 1) {
+		a.Equal("friend.example.org", pinned[0].Addr)
+		a.Equal(uint(1), pinned[0].Valency)
+	}
+}
+
+func TestPeerFilterAllow(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := cardanocfg.NewPeerFilter(config.PeerFilter{
+		Allow: []string{"*.pool.io", "192.0.2.0/24"},
+		Block: []string{"bad.pool.io"},
+	})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	a.True(f.Allowed("relay.pool.io"))
+	a.True(f.Allowed("192.0.2.10"))
+	a.False(f.Allowed("bad.pool.io"))
+	a.False(f.Allowed("192.0.3.10"))
+
+	_, err = cardanocfg.NewPeerFilter(config.PeerFilter{Block: []string{"10.0.0.0/33"}})
+	a.NotNil(err)
+}
@@ -0,0 +1,132 @@
+package cardanocfg_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+)
+
+const pipelineConfig = `
+config_uri: %s
+producers:
+  - pool: "test"
+    host: "producer.example.com"
+    network: "mainnet"
+    root_dir: %s
+    is_producer: true
+relays:
+  - pool: "test"
+    host: "relay0.example.com"
+    network: "mainnet"
+    port: 3001
+`
+
+func TestDownloadConfigFiles(t *testing.T) {
+	a := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, cardanocfg.ShelleyGenesis):
+			fmt.Fprint(w, `{"networkMagic": 764824073}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestConfig(t, fmt.Sprintf(pipelineConfig, srv.URL, t.TempDir()))
+	d, err := cardanocfg.New(&c.Producers[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	files, err := d.DownloadConfigFiles(context.Background())
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(uint64(764824073), files.NetworkMagic)
+	a.Equal(uint64(764824073), c.Producers[0].NetworkMagic)
+	a.FileExists(files.ConfigJSON)
+	a.FileExists(files.ByronGenesis)
+	a.FileExists(files.ShelleyGenesis)
+	a.FileExists(files.Topology)
+}
+
+func TestDownloadConfigFilesErrors(t *testing.T) {
+	a := assert.New(t)
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	c := newTestConfig(t, fmt.Sprintf(pipelineConfig, srv.URL, t.TempDir()))
+	d, err := cardanocfg.New(&c.Producers[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	files, err := d.DownloadConfigFiles(context.Background())
+	if a.NotNil(err) {
+		errs, ok := err.(cardanocfg.DownloadErrors)
+		a.True(ok)
+		a.Len(errs, 3)
+	}
+	a.Empty(files.Topology)
+}
+
+func TestLatency(t *testing.T) {
+	a := assert.New(t)
+
+	c := newTestConfig(t, fmt.Sprintf(pipelineConfig, "http://localhost", t.TempDir()))
+	d, err := cardanocfg.New(&c.Producers[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	nodes := make(cardanocfg.NodeList, 0, 6)
+	for i := 0; i < 5; i++ {
+		l, er := net.Listen("tcp4", "127.0.0.1:0")
+		if !a.Nil(er) {
+			t.FailNow()
+		}
+		defer l.Close()
+		go func() {
+			for {
+				conn, e := l.Accept()
+				if e != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		nodes = append(nodes, cardanocfg.Node{
+			Addr: "127.0.0.1",
+			Port: uint(l.Addr().(*net.TCPAddr).Port),
+		})
+	}
+
+	// a port nobody listens on
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	closedPort := uint(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+	nodes = append(nodes, cardanocfg.Node{Addr: "127.0.0.1", Port: closedPort})
+
+	relays, err := d.TestLatency(context.Background(), nodes)
+	a.Nil(err)
+	a.Len(relays, 5)
+	for i := range relays {
+		a.NotEqual(closedPort, relays[i].Port)
+		a.True(relays[i].GetLatency() > 0)
+	}
+}
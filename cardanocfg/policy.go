@@ -0,0 +1,92 @@
+package cardanocfg
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+// discoveredBudget returns the maximum number of discovered peers and the
+// number of candidates to probe to select them.
+func (d *Downloader) discoveredBudget() (max, sample int) {
+	policy := d.node.TopologyPolicy
+	max = int(policy.MaxDiscovered)
+	sample = int(math.Ceil(float64(max) * policy.Oversampling))
+	return max, sample
+}
+
+// oversample returns the candidates to probe, at most the discovered
+// budget's sample.
+func (d *Downloader) oversample(candidates NodeList) NodeList {
+	_, sample := d.discoveredBudget()
+	if sample < len(candidates) {
+		return candidates[:sample]
+	}
+	return candidates
+}
+
+// ApplyPolicy checks that enough discovered peers qualified, discoverErr
+// is the error that stopped the discovery if any. The discovered peers that
+// SanitizeTopology drops next to current, bogons, unresolvable entries, the
+// node itself and duplicates, do not qualify. When too few did, the node's
+// insufficient policy decides whether to fail, go on with what was found,
+// or use the discovered peers of the cached topology, the entries of the
+// cached file that are not in current.
+func (d *Downloader) ApplyPolicy(current Topology, discovered NodeList, discoverErr error) (NodeList, error) {
+	policy := d.node.TopologyPolicy
+	if discoverErr != nil {
+		d.log.Errorf("discovering peers: %s", discoverErr.Error())
+	}
+	discovered = d.sanitizeDiscovered(current, discovered)
+	if uint(len(discovered)) >= policy.MinDiscovered {
+		return discovered, nil
+	}
+
+	msg := fmt.Sprintf("only %d discovered peers qualified, %d required", len(discovered), policy.MinDiscovered)
+	switch policy.Insufficient {
+	case config.InsufficientFail:
+		if discoverErr != nil {
+			return nil, fmt.Errorf("%s: %s", msg, discoverErr.Error())
+		}
+		return nil, fmt.Errorf("%s", msg)
+	case config.InsufficientCached:
+		cached, err := d.cachedDiscovered(current)
+		if err != nil {
+			return nil, fmt.Errorf("%s and the cached topology is not usable: %s", msg, err.Error())
+		}
+		d.log.Warnf("%s, using %d discovered peers from the cached topology", msg, len(cached))
+		return cached, nil
+	}
+	d.log.Warnf("%s, going on with them", msg)
+	return discovered, nil
+}
+
+// cachedDiscovered returns the entries of the node's topology file that
+// are not in current.
+func (d *Downloader) cachedDiscovered(current Topology) (NodeList, error) {
+	filePath, err := d.GetFilePath(TopologyJSON, false)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := loadTopology(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(current.Producers))
+	for _, p := range current.Producers {
+		known[peerKey(normalizeHost(p.Addr), p.Port)] = true
+	}
+	discovered := make(NodeList, 0, len(cached.Producers))
+	for _, p := range cached.Producers {
+		if known[peerKey(normalizeHost(p.Addr), p.Port)] || d.isCurated(&p) {
+			continue
+		}
+		discovered = append(discovered, p)
+	}
+	if len(discovered) == 0 {
+		return nil, fmt.Errorf("no discovered peers in %s", filePath)
+	}
+	return discovered, nil
+}
@@ -0,0 +1,171 @@
+package cardanocfg_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/config"
+)
+
+const policyConfig = `
+config_uri: http://config.test
+http:
+  proxy: %s
+  retries: 1
+  backoff: 1ms
+producers:
+  - pool: "test"
+    host: "producer.example.com"
+    network: "mainnet"
+relays:
+  - pool: "test"
+    host: "relay0.example.com"
+    network: "mainnet"
+    port: 3001
+    root_dir: %s
+    topology_policy:
+      min_discovered: 2
+      insufficient: %s
+      omit_internal: %v
+`
+
+// policyProxy serves the bootstrap topology and fails every other
+// download, the peer discovery never finds anything.
+func policyProxy(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "config.test" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"Producers": [{"addr": "8.8.4.4", "port": 3001, "valency": 1}]}`)
+			return
+		}
+		http.Error(w, "blocked", http.StatusForbidden)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func policyTopology(t *testing.T, insufficient string, omitInternal bool, cached *cardanocfg.Topology) ([]string, error) {
+	dir := t.TempDir()
+	c := newTestConfig(t, fmt.Sprintf(policyConfig, policyProxy(t).URL, dir, insufficient, omitInternal))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached != nil {
+		path, er := d.GetFilePath(cardanocfg.TopologyJSON, false)
+		if er != nil {
+			t.Fatal(er)
+		}
+		b, _ := json.Marshal(cached)
+		if er = os.MkdirAll(filepath.Dir(path), 0o755); er != nil {
+			t.Fatal(er)
+		}
+		if er = ioutil.WriteFile(path, b, 0o600); er != nil {
+			t.Fatal(er)
+		}
+	}
+
+	top, err := d.BuildTopology(context.Background())
+	addrs := make([]string, len(top.Producers))
+	for i, p := range top.Producers {
+		addrs[i] = fmt.Sprintf("%s:%d", p.Addr, p.Port)
+	}
+	return addrs, err
+}
+
+func TestTopologyPolicy(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := policyTopology(t, "fail", false, nil)
+	a.NotNil(err)
+
+	addrs, err := policyTopology(t, "warn", false, nil)
+	a.Nil(err)
+	a.Equal([]string{"8.8.4.4:3001", "producer.example.com:3100"}, addrs)
+
+	addrs, err = policyTopology(t, "warn", true, nil)
+	a.Nil(err)
+	a.Equal([]string{"8.8.4.4:3001"}, addrs)
+
+	cached := &cardanocfg.Topology{Producers: []cardanocfg.Node{
+		{Addr: "8.8.4.4", Port: 3001, Valency: 1},
+		{Addr: "producer.example.com", Port: 3100, Valency: 1},
+		{Addr: "9.9.9.9", Port: 3001, Valency: 1},
+		{Addr: "1.0.0.1", Port: 3001, Valency: 1},
+	}}
+	addrs, err = policyTopology(t, "cached", false, cached)
+	a.Nil(err)
+	a.Equal([]string{"8.8.4.4:3001", "producer.example.com:3100", "9.9.9.9:3001", "1.0.0.1:3001"}, addrs)
+
+	_, err = policyTopology(t, "cached", false, nil)
+	a.NotNil(err)
+}
+
+func TestTopologyPolicyValidation(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gocnode.yaml")
+	if !a.Nil(ioutil.WriteFile(path, []byte(fmt.Sprintf(policyConfig, "http://localhost", dir, "panic", false)), 0o600)) {
+		t.FailNow()
+	}
+	_, err := config.New(path, true, "debug")
+	a.NotNil(err)
+}
+
+const sanitizedPolicyConfig = `
+relays:
+  - pool: "test"
+    host: "5.5.5.5"
+    network: "mainnet"
+    port: 3001
+    root_dir: %s
+    topology_policy:
+      min_discovered: 2
+      insufficient: %s
+`
+
+func TestTopologyPolicySanitized(t *testing.T) {
+	a := assert.New(t)
+
+	current := cardanocfg.Topology{Producers: []cardanocfg.Node{{Addr: "8.8.4.4", Port: 3001, Valency: 1, Internal: true}}}
+	// only 1.0.0.1 is left once sanitized
+	discovered := cardanocfg.NodeList{
+		{Addr: "10.0.0.1", Port: 3001, Valency: 1},
+		{Addr: "8.8.4.4", Port: 3001, Valency: 1},
+		{Addr: "5.5.5.5", Port: 3001, Valency: 1},
+		{Addr: "1.0.0.1", Port: 3001, Valency: 1},
+	}
+
+	c := newTestConfig(t, fmt.Sprintf(sanitizedPolicyConfig, t.TempDir(), "fail"))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	_, err = d.ApplyPolicy(current, discovered, nil)
+	if a.NotNil(err) {
+		a.Contains(err.Error(), "only 1 discovered peers qualified")
+	}
+
+	c = newTestConfig(t, fmt.Sprintf(sanitizedPolicyConfig, t.TempDir(), "warn"))
+	d, err = cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	kept, err := d.ApplyPolicy(current, discovered, nil)
+	a.Nil(err)
+	if a.Len(kept, 1) {
+		a.Equal("1.0.0.1", kept[0].Addr)
+	}
+}
@@ -0,0 +1,199 @@
+package cardanocfg
+
+import (
+	"net"
+	"strings"
+)
+
+// bogons are the ranges that are never reachable on the public internet:
+// private, loopback, link local, CGNAT, documentation, benchmarking,
+// multicast and reserved addresses.
+var bogons = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b:1::/48",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// IsBogon reports whether ip can not be a public peer.
+func IsBogon(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range bogons {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfIPs returns the addresses the node can be reached at: its configured
+// ip and host and the addresses of the local interfaces.
+func (d *Downloader) selfIPs() []net.IP {
+	ips := make([]net.IP, 0)
+	if ip := net.ParseIP(d.node.IP); ip != nil {
+		ips = append(ips, ip)
+	}
+	if d.node.Host != "" {
+		if hostIPs, err := d.lookupIP(d.node.Host); err == nil {
+			ips = append(ips, hostIPs...)
+		}
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				ips = append(ips, n.IP)
+			}
+		}
+	}
+	return ips
+}
+
+// lookupIP resolves host, IP literals are returned as is.
+func (d *Downloader) lookupIP(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return net.LookupIP(host)
+}
+
+// SanitizeTopology removes the entries of top the node should not peer
+// with:
+//
+//   - entries that resolve to the node itself, on the node's port
+//   - entries whose addresses are all already in the topology, internal
+//     entries win over discovered ones
+//   - discovered entries with private or bogon addresses
+//   - discovered entries that do not resolve
+//
+// Internal entries that do not resolve are kept, cardano-node retries
+// them.
+func (d *Downloader) SanitizeTopology(top Topology) Topology {
+	keep := d.sanitize(top)
+	sanitized := Topology{Producers: make([]Node, 0, len(top.Producers))}
+	dropped := make([]string, 0)
+	for i := range top.Producers {
+		if keep[i] {
+			sanitized.Producers = append(sanitized.Producers, top.Producers[i])
+			continue
+		}
+		dropped = append(dropped, peerKey(top.Producers[i].Addr, top.Producers[i].Port))
+	}
+	if len(dropped) > 0 {
+		d.log.Infof("sanitizer dropped %d peers: %s", len(dropped), strings.Join(dropped, ", "))
+	}
+	return sanitized
+}
+
+// sanitizeDiscovered returns the entries of discovered that SanitizeTopology
+// keeps when they are added to current.
+func (d *Downloader) sanitizeDiscovered(current Topology, discovered NodeList) NodeList {
+	all := Topology{Producers: make([]Node, 0, len(current.Producers)+len(discovered))}
+	all.Producers = append(all.Producers, current.Producers...)
+	all.Producers = append(all.Producers, discovered...)
+	keep := d.sanitize(all)[len(current.Producers):]
+
+	kept := make(NodeList, 0, len(discovered))
+	for i := range discovered {
+		if keep[i] {
+			kept = append(kept, discovered[i])
+		}
+	}
+	if dropped := len(discovered) - len(kept); dropped > 0 {
+		d.log.Infof("sanitizer dropped %d discovered peers", dropped)
+	}
+	return kept
+}
+
+// sanitize reports which entries of top SanitizeTopology keeps.
+func (d *Downloader) sanitize(top Topology) []bool {
+	self := make(map[string]bool)
+	for _, ip := range d.selfIPs() {
+		self[ip.String()] = true
+	}
+
+	seen := make(map[string]bool)
+	keep := make([]bool, len(top.Producers))
+	check := func(i int) {
+		p := &top.Producers[i]
+		ips, err := d.lookupIP(p.Addr)
+		if err != nil {
+			if p.Internal {
+				d.log.Warnf("keeping internal peer %s, it does not resolve: %s", p.Addr, err.Error())
+				keep[i] = true
+			} else {
+				d.log.Warnf("dropping peer %s, it does not resolve: %s", p.Addr, err.Error())
+			}
+			return
+		}
+
+		dup := len(ips) > 0
+		for _, ip := range ips {
+			if p.Port == d.node.Port && self[ip.String()] {
+				d.log.Warnf("dropping peer %s, %s is the node itself", p.Addr, ip)
+				return
+			}
+			if !p.Internal && IsBogon(ip) {
+				d.log.Warnf("dropping discovered peer %s, %s is not a public address", p.Addr, ip)
+				return
+			}
+			if !seen[peerKey(ip.String(), p.Port)] {
+				dup = false
+			}
+		}
+		if dup {
+			d.log.Infof("dropping peer %s, its addresses are already in the topology", p.Addr)
+			return
+		}
+		for _, ip := range ips {
+			seen[peerKey(ip.String(), p.Port)] = true
+		}
+		keep[i] = true
+	}
+
+	// internal entries first so that they win over duplicated discovered
+	// ones
+	for i := range top.Producers {
+		if top.Producers[i].Internal {
+			check(i)
+		}
+	}
+	for i := range top.Producers {
+		if !top.Producers[i].Internal {
+			check(i)
+		}
+	}
+
+	return keep
+}
@@ -0,0 +1,58 @@
+package cardanocfg_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+)
+
+func TestIsBogon(t *testing.T) {
+	a := assert.New(t)
+
+	for _, ip := range []string{"10.1.2.3", "172.16.0.1", "192.168.1.1", "127.0.0.1", "100.64.0.1", "::1", "fd00::1", "fe80::1", "::ffff:192.168.1.1"} {
+		a.True(cardanocfg.IsBogon(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"1.1.1.1", "5.9.10.11", "172.32.0.1", "2a01:4f8::1"} {
+		a.False(cardanocfg.IsBogon(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestSanitizeTopology(t *testing.T) {
+	a := assert.New(t)
+
+	c := newTestConfig(t, fmt.Sprintf(pipelineConfig, "http://localhost", t.TempDir()))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	top := cardanocfg.Topology{Producers: []cardanocfg.Node{
+		{Addr: "127.0.0.1", Port: 3001, Internal: true},
+		{Addr: "192.168.1.10", Port: 3001, Internal: true},
+		{Addr: "10.0.0.1", Port: 3001},
+		{Addr: "1.1.1.1", Port: 3001},
+		{Addr: "1.1.1.1", Port: 3001},
+		{Addr: "1.1.1.1", Port: 3002},
+		{Addr: "relay.invalid", Port: 3001},
+		{Addr: "producer.invalid", Port: 3001, Internal: true},
+		{Addr: "8.8.8.8", Port: 3001},
+		{Addr: "8.8.8.8", Port: 3001, Internal: true},
+	}}
+
+	sanitized := d.SanitizeTopology(top)
+	kept := make([]string, len(sanitized.Producers))
+	for i, p := range sanitized.Producers {
+		kept[i] = fmt.Sprintf("%s:%d:%v", p.Addr, p.Port, p.Internal)
+	}
+	a.Equal([]string{
+		"192.168.1.10:3001:true",
+		"1.1.1.1:3001:false",
+		"1.1.1.1:3002:false",
+		"producer.invalid:3001:true",
+		"8.8.8.8:3001:true",
+	}, kept)
+}
@@ -1,6 +1,7 @@
 package cardanocfg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,38 +16,51 @@ import (
 	"github.com/k0kubun/pp"
 
 	"github.com/adakailabs/gocnode/fastping"
+	"github.com/adakailabs/gocnode/prober"
 
 	"github.com/prometheus/common/log"
 )
 
 const regularRelay = "regular"
 
-func (d *Downloader) DownloadAndSetTopologyFileRelay() (top Topology, err error) {
+func (d *Downloader) DownloadAndSetTopologyFileRelay(ctx context.Context) (top Topology, err error) {
 	d.log.Info("node is not producer")
-	top, err = d.DownloadTopologyJSON(d.node.Network)
+	top, err = d.DownloadTopologyJSON(ctx, d.node.Network)
 	if err != nil {
 		return top, err
 	}
 
+	top.Producers = d.FilterPeers(top.Producers)
+	top.Producers = d.FilterFamily(top.Producers)
+
 	actualProducersdd := make([]Node, 0, 4)
-	for _, p := range d.node.ExtProducer {
-		aP := Node{}
-		aP.Addr = p.Host
-		aP.Port = p.Port
-		aP.Atype = regularRelay
-		aP.Valency = 1
-		actualProducersdd = append(actualProducersdd, aP)
-	}
-	for i := range d.conf.Producers {
-		if d.node.Pool != d.conf.Producers[i].Pool {
-			continue
+	for _, p := range d.filter.Pinned() {
+		d.log.Infof("adding pinned peer: %s:%d", p.Addr, p.Port)
+		p.Internal = true
+		actualProducersdd = append(actualProducersdd, p)
+	}
+	if !d.node.TopologyPolicy.OmitInternal {
+		for _, p := range d.node.ExtProducer {
+			aP := Node{}
+			aP.Addr = p.Host
+			aP.Port = p.Port
+			aP.Atype = regularRelay
+			aP.Valency = 1
+			aP.Internal = true
+			actualProducersdd = append(actualProducersdd, aP)
+		}
+		for i := range d.conf.Producers {
+			if d.node.Pool != d.conf.Producers[i].Pool {
+				continue
+			}
+			aP := Node{}
+			aP.Addr = d.conf.Producers[i].Host
+			aP.Port = d.conf.Producers[i].Port
+			aP.Atype = regularRelay
+			aP.Valency = 1
+			aP.Internal = true
+			actualProducersdd = append(actualProducersdd, aP)
 		}
-		aP := Node{}
-		aP.Addr = d.conf.Producers[i].Host
-		aP.Port = d.conf.Producers[i].Port
-		aP.Atype = regularRelay
-		aP.Valency = 1
-		actualProducersdd = append(actualProducersdd, aP)
 	}
 	top.Producers = append(top.Producers, actualProducersdd...)
 
@@ -63,76 +77,93 @@ func (d *Downloader) DownloadAndSetTopologyFileProducer() (top Topology, err err
 		top.Producers[i].Valency = 1
 		top.Producers[i].Addr = r.Host
 		top.Producers[i].Atype = regularRelay
+		top.Producers[i].Internal = true
 	}
 	return top, err
 }
 
-func (d *Downloader) DownloadAndSetTopologyFile() error {
-	var top Topology
-	var err error
-	var filePath string
-
-	if filePath, err = d.GetFilePath(TopologyJSON, false); err != nil {
-		return err
+// BuildTopology returns the sanitized topology the node would use, without
+// writing it. The curated peers of the node's peer_files come first.
+func (d *Downloader) BuildTopology(ctx context.Context) (top Topology, err error) {
+	if top, err = d.discoverTopology(ctx); err != nil {
+		return top, err
 	}
+	return d.finishTopology(top)
+}
 
+// discoverTopology returns the internal and discovered peers of the node.
+func (d *Downloader) discoverTopology(ctx context.Context) (top Topology, err error) {
 	if !d.node.IsProducer {
-		top, err = d.DownloadAndSetTopologyFileRelay()
+		top, err = d.DownloadAndSetTopologyFileRelay(ctx)
 		if err != nil {
-			return err
+			return top, err
 		}
 	} else {
 		top, err = d.DownloadAndSetTopologyFileProducer()
 		if err != nil {
-			return err
+			return top, err
 		}
 	}
 
-	newBytes, err := json.MarshalIndent(&top, "", "   ")
+	if !d.node.IsProducer {
+		var topOthers Topology
+		if d.node.Network == Mainnet {
+			topOthers, err = d.MainNetRelays(ctx)
+		} else {
+			topOthers, err = d.TestNetRelays(ctx)
+			pp.Println("topOthers", topOthers)
+		}
+		discovered, er := d.ApplyPolicy(top, topOthers.Producers, err)
+		if er != nil {
+			return top, er
+		}
+		top.Producers = append(top.Producers, discovered...)
+	}
+	return top, nil
+}
+
+// finishTopology merges the curated peers into top and sanitizes it.
+func (d *Downloader) finishTopology(top Topology) (Topology, error) {
+	curated, err := d.CuratedPeers()
+	if err != nil {
+		return top, err
+	}
+	return d.SanitizeTopology(d.mergeCurated(top, curated)), nil
+}
+
+func (d *Downloader) DownloadAndSetTopologyFile(ctx context.Context) error {
+	filePath, err := d.GetFilePath(TopologyJSON, false)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(filePath, newBytes, os.ModePerm)
+	// discovering takes a while, it runs before taking the topology lock
+	// and the peers demoted or curated meanwhile are applied under it
+	top, err := d.discoverTopology(ctx)
 	if err != nil {
 		return err
 	}
 
-	if !d.node.IsProducer {
-		var topOthers Topology
-		if d.node.Network == Mainnet {
-			topOthers, err = d.MainNetRelays()
-		} else {
-			topOthers, err = d.TestNetRelays()
-			pp.Println("topOthers", topOthers)
-		}
-		if err != nil {
-			d.log.Errorf(err.Error())
-		}
-		top.Producers = append(top.Producers, topOthers.Producers...)
-		newBytes, err := json.MarshalIndent(&top, "", "   ")
-		if err != nil {
-			d.log.Errorf(err.Error())
-		}
-		err = ioutil.WriteFile(filePath, newBytes, os.ModePerm)
-		if err != nil {
-			d.log.Errorf(err.Error())
-		}
-		log.Info("filePath:", filePath)
+	err = d.updateTopology(filePath, func(Topology) (Topology, error) {
+		return d.finishTopology(d.dropDemoted(top))
+	})
+	if err != nil {
+		return err
 	}
+	log.Info("filePath:", filePath)
 
 	return nil
 }
 
-func (d *Downloader) DownloadTopologyJSON(aNet string) (Topology, error) {
+func (d *Downloader) DownloadTopologyJSON(ctx context.Context, aNet string) (Topology, error) {
 	filePathTmpTop, err := d.GetFilePath(TopologyJSON, true)
 	if err != nil {
 		return Topology{}, err
 	}
 
-	url := fmt.Sprintf("%s/%s-%s", URI, aNet, TopologyJSON)
+	url := fmt.Sprintf("%s/%s-%s", d.conf.ConfigURI, aNet, TopologyJSON)
 
-	err = d.DownloadFile(filePathTmpTop, url)
+	err = d.DownloadFile(ctx, filePathTmpTop, url)
 	if err != nil {
 		return Topology{}, err
 	}
@@ -153,7 +184,64 @@ func (d *Downloader) DownloadTopologyJSON(aNet string) (Topology, error) {
 	return top, nil
 }
 
-func (d *Downloader) TestLatency(newProduces NodeList) (finalProducers NodeList, err error) {
+// newProber returns a prober limited by the node's probe settings that
+// logs the progress of the run.
+func (d *Downloader) newProber(what string) *prober.Prober {
+	return prober.New(prober.Config{
+		Parallelism: int(d.node.Probe.Parallelism),
+		Timeout:     d.node.Probe.Timeout,
+		Progress: func(done, total int) {
+			if done == total || done%10 == 0 {
+				d.log.Infof("%s: probed %d of %d relays", what, done, total)
+			}
+		},
+	})
+}
+
+// networkMagic returns the node's network magic, or the well known one for
+// its network when the genesis file was not read yet.
+func (d *Downloader) networkMagic() uint64 {
+	switch {
+	case d.node.NetworkMagic != 0:
+		return d.node.NetworkMagic
+	case d.node.Network == Mainnet:
+		return MainnetMagic
+	}
+	return TestnetMagic
+}
+
+// measure probes p with method and records the statistics in p, an error
+// is returned when p did not answer or lost more than max_packet_loss
+// percent of the probes.
+func (d *Downloader) measure(ctx context.Context, p *Node, method fastping.Method) error {
+	res, err := fastping.Measure(ctx, p.Addr, fastping.Options{
+		Method:   method,
+		Fallback: fastping.Method(d.node.Probe.Fallback),
+		Network:  d.pingNetwork(),
+		Port:     p.Port,
+		Magic:    d.networkMagic(),
+		Count:    int(d.node.Probe.Count),
+		Size:     int(d.node.Probe.Size),
+		Interval: d.node.Probe.Interval,
+		Timeout:  d.node.Probe.SampleTimeout,
+	})
+	p.Stats = res
+	if err != nil {
+		d.log.Warnf("relay %s did not pass %s latency test: %s", p.Addr, res.Method, err.Error())
+		return err
+	}
+	if res.PacketLoss > d.node.Probe.MaxPacketLoss {
+		d.log.Warnf("droping relay %s due to packet loss: %s", p.Addr, res.String())
+		return fmt.Errorf("relay %s lost %.1f%% of the packets", p.Addr, res.PacketLoss)
+	}
+	p.SetLatency(res.AvgRtt)
+	d.log.Infof("relay %s latency: %s", p.Addr, res.String())
+	return nil
+}
+
+// TestLatency measures the time it takes to open TCP connections to each
+// relay and returns the relays that accepted them, sorted by latency.
+func (d *Downloader) TestLatency(ctx context.Context, newProduces NodeList) (finalProducers NodeList, err error) {
 	rand.Shuffle(len(newProduces),
 		func(i, j int) {
 			newProduces[i],
@@ -161,51 +249,34 @@ func (d *Downloader) TestLatency(newProduces NodeList) (finalProducers NodeList,
 				newProduces[i]
 		})
 
-	nodeChan := make(chan Node)
-	defer close(nodeChan)
+	ctx, cancel := context.WithTimeout(ctx, d.node.Probe.Deadline)
+	defer cancel()
 
-	testNode := func(p Node) {
-		var conn net.Conn
+	ok := make([]bool, len(newProduces))
+	done := d.newProber("tcp latency").Run(ctx, len(newProduces), func(ctx context.Context, i int) {
+		p := &newProduces[i]
 		d.log.Info("testing relay: ", p.Addr)
-		now := time.Now()
-		conn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", p.Addr, p.Port))
-		if err != nil {
-			d.log.Warnf("%s: %s", p.Addr, err.Error())
-		} else {
-			duration := time.Since(now)
-			conn.Close()
-			p.SetLatency(duration)
-			nodeChan <- p
-			d.log.Infof("relay %s latency: %v", p.Addr, duration)
-		}
+		ok[i] = d.measure(ctx, p, fastping.MethodTCP) == nil
+	})
+	if done < len(newProduces) {
+		d.log.Warnf("probe deadline reached after testing %d of %d relays", done, len(newProduces))
 	}
 
-	for _, p := range newProduces {
-		go testNode(p)
-	}
-
-	c := time.NewTimer(time.Second * 15)
-
-	for {
-		select {
-		case <-c.C:
-			d.log.Warn("node tests time count, number of nodes that meet the criteria is: ", len(finalProducers))
-			sort.Sort(finalProducers)
-			return finalProducers, err
-
-		case p := <-nodeChan:
-			finalProducers = append(finalProducers, p)
-			if len(finalProducers) == len(newProduces) {
-				sort.Sort(finalProducers)
-				return finalProducers, err
-			}
+	for i := range newProduces {
+		if ok[i] {
+			finalProducers = append(finalProducers, newProduces[i])
 		}
 	}
-	// sort.Sort(finalProducers)
-	// return finalProducers, fmt.Errorf("unexpected function end")
+	sort.Sort(finalProducers)
+	return finalProducers, nil
 }
 
-func (d *Downloader) TestLatencyWithPing(newProduces NodeList) (allLostPackets, finalProducers NodeList, err error) {
+// TestLatencyWithPing pings each relay, or measures it with the probe
+// fallback method when ICMP is not available. Relays that lose at most
+// max_packet_loss percent of the probes are returned sorted by latency in
+// finalProducers, relays that did not answer any are returned in
+// allLostPackets so they can be tested otherwise.
+func (d *Downloader) TestLatencyWithPing(ctx context.Context, newProduces NodeList) (allLostPackets, finalProducers NodeList, err error) {
 	rand.Shuffle(len(newProduces),
 		func(i, j int) {
 			newProduces[i],
@@ -213,61 +284,51 @@ func (d *Downloader) TestLatencyWithPing(newProduces NodeList) (allLostPackets,
 				newProduces[i]
 		})
 
-	nodeChan := make(chan Node)
-	defer close(nodeChan)
-	allLostPackets = make(NodeList, 0)
-
-	testNode := func(p Node) {
-		var duration time.Duration
-		var packetLoss float64
+	ctx, cancel := context.WithTimeout(ctx, d.node.Probe.Deadline)
+	defer cancel()
 
+	const (
+		untested = iota
+		passed
+		allLost
+	)
+	if d.node.Probe.Method == string(fastping.MethodAuto) && !fastping.ICMPAvailable() {
+		d.log.Warnf("icmp is not available, measuring latency with %s", d.node.Probe.Fallback)
+	}
+	results := make([]int, len(newProduces))
+	done := d.newProber("ping latency").Run(ctx, len(newProduces), func(ctx context.Context, i int) {
+		p := &newProduces[i]
 		d.log.Info("testing relay: ", p.Addr)
-		duration, packetLoss, err = fastping.TestAddress(p.Addr)
-		if err != nil {
-			d.log.Warnf("addresss %s did not pass latency test: %s", p.Addr, err.Error())
-			if packetLoss == 100 {
-				allLostPackets = append(allLostPackets, p)
-			} else {
-				if packetLoss > 0 {
-					d.log.Warnf("droping relay %s due to packet loss test", p.Addr)
-				}
+		if err := d.measure(ctx, p, fastping.Method(d.node.Probe.Method)); err != nil {
+			if p.Stats.Received == 0 {
+				results[i] = allLost
 			}
-		} else {
-			p.SetLatency(duration)
-			nodeChan <- p
-			d.log.Infof("relay %s latency: %v", p.Addr, duration)
+			return
 		}
+		results[i] = passed
+	})
+	if done < len(newProduces) {
+		d.log.Warnf("probe deadline reached after testing %d of %d relays", done, len(newProduces))
 	}
 
-	for _, p := range newProduces {
-		go testNode(p)
-	}
-
-	c := time.NewTimer(time.Second * 60)
-
-	for {
-		select {
-		case <-c.C:
-			d.log.Warn("node tests time count, number of nodes that meet the criteria is: ", len(finalProducers))
-			sort.Sort(finalProducers)
-			return allLostPackets, finalProducers, err
-
-		case p := <-nodeChan:
-			finalProducers = append(finalProducers, p)
-			if len(finalProducers) == len(newProduces) {
-				sort.Sort(finalProducers)
-				return allLostPackets, finalProducers, err
-			}
+	allLostPackets = make(NodeList, 0)
+	for i := range newProduces {
+		switch results[i] {
+		case passed:
+			finalProducers = append(finalProducers, newProduces[i])
+		case allLost:
+			allLostPackets = append(allLostPackets, newProduces[i])
 		}
 	}
-	// return allLostPackets, finalProducers, fmt.Errorf("unexpected function end")
+	sort.Sort(finalProducers)
+	return allLostPackets, finalProducers, nil
 }
 
-func (d *Downloader) GetTestNetRelays() (tp Topology, newProduces []Node, err error) {
+func (d *Downloader) GetTestNetRelays(ctx context.Context) (tp Topology, newProduces []Node, err error) {
 	rand.Seed(time.Now().UnixNano()) // FIXME
 	const URI = "https://explorer.cardano-testnet.iohkdev.io/relays/topology.json"
 	const tmpPath = "/tmp/testnet.json"
-	if er := d.DownloadFile(tmpPath, URI); er != nil {
+	if er := d.DownloadFile(ctx, tmpPath, URI); er != nil {
 		er = errors.Annotatef(er, "while attempting to download: %s", tmpPath)
 		return tp, newProduces, er
 	}
@@ -301,42 +362,42 @@ func (d *Downloader) GetTestNetRelays() (tp Topology, newProduces []Node, err er
 		p.Valency = 1
 		newProduces = append(newProduces, p)
 	}
+	newProduces = d.FilterPeers(newProduces)
+	newProduces = d.FilterFamily(newProduces)
 	return tp, newProduces, err
 }
 
+// SetValency sets the valency of the relays given by name to the number
+// of addresses they resolve to, relays that do not resolve are dropped.
 func (d *Downloader) SetValency(relays NodeList) (NodeList, error) {
+	valid := make(NodeList, 0, len(relays))
 	for i := range relays {
 		addr := net.ParseIP(relays[i].Addr)
 		if addr == nil {
 			if relays[i].Valency < 2 {
-				ipList, err := net.LookupIP(relays[i].Addr)
+				ipList, err := d.familyIPs(relays[i].Addr)
 				if err != nil {
-					return relays, err
+					d.log.Warnf("dropping relay %s: %s", relays[i].Addr, err.Error())
+					continue
 				}
 				relays[i].Valency = uint(len(ipList))
 			}
 		}
+		valid = append(valid, relays[i])
 	}
 
-	return relays, nil
+	return valid, nil
 }
 
-func (d *Downloader) TestNetRelays() (tp Topology, err error) {
-	var pingRelays NodeList
-	var allLost NodeList
-	var netRelays NodeList
-	var conRelays NodeList
-
+// Rank measures the latency to the candidates, pinging them or, for the
+// ones that do not answer pings, opening TCP connections, and returns the
+// ones that answered sorted by latency.
+func (d *Downloader) Rank(ctx context.Context, candidates NodeList) (NodeList, error) {
 	relaysMap := make(map[string]bool)
 
-	tp, netRelays, err = d.GetTestNetRelays()
-	if err != nil {
-		return
-	}
-
-	allLost, pingRelays, err = d.TestLatencyWithPing(netRelays)
+	allLost, pingRelays, err := d.TestLatencyWithPing(ctx, candidates)
 	if err != nil {
-		return tp, err
+		return nil, err
 	}
 
 	for i := range pingRelays {
@@ -344,19 +405,19 @@ func (d *Downloader) TestNetRelays() (tp Topology, err error) {
 	}
 
 	for _, p := range pingRelays {
-		key := fmt.Sprintf("%s:%d", p.Addr, p.Port)
+		key := peerKey(p.Addr, p.Port)
 		relaysMap[key] = true
 	}
 
-	conRelays, err = d.TestLatency(allLost)
+	conRelays, err := d.TestLatency(ctx, allLost)
 	if err != nil {
-		return tp, err
+		return nil, err
 	}
 
 	relays := pingRelays
 
 	for _, r := range conRelays {
-		key := fmt.Sprintf("%s:%d", r.Addr, r.Port)
+		key := peerKey(r.Addr, r.Port)
 		_, ok := relaysMap[key]
 		if !ok {
 			d.log.Warnf("adding con relay: %s", r.Addr)
@@ -364,93 +425,76 @@ func (d *Downloader) TestNetRelays() (tp Topology, err error) {
 			relays = append(relays, r)
 		}
 	}
+	sort.Stable(relays)
+	return relays, nil
+}
+
+func (d *Downloader) TestNetRelays(ctx context.Context) (tp Topology, err error) {
+	var netRelays NodeList
+	var relays NodeList
+
+	tp, netRelays, err = d.GetTestNetRelays(ctx)
+	if err != nil {
+		return
+	}
+
+	if relays, err = d.Rank(ctx, d.oversample(netRelays)); err != nil {
+		return tp, err
+	}
 
 	relays, err = d.SetValency(relays)
 	if err != nil {
 		return Topology{}, err
 	}
 
-	if len(relays) > int(d.node.Peers) {
-		tp.Producers = relays[0:d.node.Peers]
-	} else {
-		tp.Producers = relays
-	}
+	max, _ := d.discoveredBudget()
+	relays = d.AnalyzePaths(ctx, relays)
+	tp.Producers, err = d.SelectDiverse(relays, max)
 
 	return tp, err
 }
 
-func (d *Downloader) MainNetRelays() (Topology, error) {
-	rand.Seed(time.Now().UnixNano()) // FIXME
-	const URI = "https://a.adapools.org/topology?geo=us&limit=50"
-	const tmpPath = "/tmp/testnet.json"
-	if err := d.DownloadFile(tmpPath, URI); err != nil {
-		return Topology{}, err
-	}
-
-	topOthers := Topology{}
-	fBytesOthers, err := ioutil.ReadFile(tmpPath)
+func (d *Downloader) MainNetRelays(ctx context.Context) (Topology, error) {
+	newProduces, err := d.MainnetDownloadNodes(ctx)
 	if err != nil {
 		return Topology{}, err
 	}
-	err = json.Unmarshal(fBytesOthers, &topOthers)
+	topOthers := Topology{}
+
+	finalProducers, err := d.TestLatency(ctx, d.oversample(newProduces))
 	if err != nil {
 		return Topology{}, err
 	}
 
-	newProduces := make([]Node, 0, len(topOthers.Producers))
-	finalProducers := make([]Node, 0, 30)
-	for _, p := range topOthers.Producers {
-		found := false
-
-		for _, i := range d.node.Relays {
-			if i.Host == p.Addr {
-				found = true
-			}
-		}
-
-		if found {
-			continue
-		}
-		newProduces = append(newProduces, p)
-	}
+	max, _ := d.discoveredBudget()
+	finalProducers = d.AnalyzePaths(ctx, finalProducers)
+	topOthers.Producers, err = d.SelectDiverse(finalProducers, max)
 
-	rand.Shuffle(len(newProduces),
-		func(i, j int) {
-			newProduces[i],
-				newProduces[j] = newProduces[j],
-				newProduces[i]
-		})
+	return topOthers, err
+}
 
-	producersTmp := newProduces[0 : d.node.Peers*3]
-	for _, p := range producersTmp {
-		now := time.Now()
-		conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", p.Addr, p.Port))
-		if err != nil {
-			d.log.Errorf("%s: %s", p.Addr, err.Error())
-		} else {
-			duration := time.Since(now)
-			conn.Close()
-			d.log.Infof("relay is good: %s -- %d ms", p.Addr, duration.Milliseconds())
-			finalProducers = append(finalProducers, p)
-		}
-	}
-	if len(finalProducers) >= int(d.node.Peers) {
-		topOthers.Producers = finalProducers[0:d.node.Peers]
-	} else {
-		topOthers.Producers = finalProducers
+// Candidates returns the discovered relays the node chooses its peers
+// from, before they are probed.
+func (d *Downloader) Candidates(ctx context.Context) (NodeList, error) {
+	if d.node.Network == Mainnet {
+		return d.MainnetDownloadNodes(ctx)
 	}
-	if len(finalProducers) == 0 {
-		panic("no relays found")
-	}
-
-	return topOthers, nil
+	_, candidates, err := d.GetTestNetRelays(ctx)
+	return candidates, err
 }
 
-func (d *Downloader) MainnetDownloadNodes() ([]Node, error) {
+// MainnetDownloadNodes downloads the list of mainnet relays, without the
+// pool's own relays and filtered by the node's peer filter and IP family,
+// in random order.
+func (d *Downloader) MainnetDownloadNodes(ctx context.Context) ([]Node, error) {
 	rand.Seed(time.Now().UnixNano()) // FIXME
-	const URI = "https://a.adapools.org/topology?geo=us&limit=50"
+	URI := "https://a.adapools.org/topology?geo=us&limit=50"
+	if d.node.Diversity.Enabled() {
+		// diversity rules need candidates from everywhere, not only the US
+		URI = "https://a.adapools.org/topology?limit=200"
+	}
 	const tmpPath = "/tmp/testnet.json"
-	if err := d.DownloadFile(tmpPath, URI); err != nil {
+	if err := d.DownloadFile(ctx, tmpPath, URI); err != nil {
 		return nil, err
 	}
 
@@ -480,6 +524,8 @@ func (d *Downloader) MainnetDownloadNodes() ([]Node, error) {
 		}
 		newNodes = append(newNodes, p)
 	}
+	newNodes = d.FilterPeers(newNodes)
+	newNodes = d.FilterFamily(newNodes)
 
 	rand.Shuffle(len(newNodes),
 		func(i, j int) {
@@ -503,7 +549,7 @@ func (d *Downloader) MainNetGetNodes() error {
 	nCount := 0
 	for _, p := range producersTmp {
 		now := time.Now()
-		conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", p.Addr, p.Port))
+		conn, err := net.Dial("tcp", net.JoinHostPort(p.Addr, strconv.Itoa(int(p.Port))))
 		if err != nil {
 			d.log.Errorf("%s: %s", p.Addr, err.Error())
 			if conn != nil {
@@ -0,0 +1,202 @@
+package cardanocfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const historyTimeFormat = "20060102T150405.000000000"
+
+// TopologyDiff lists the peers, as addr:port, added to and removed from a
+// topology file by an update.
+type TopologyDiff struct {
+	File    string   `json:"file"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+func (t TopologyDiff) Empty() bool {
+	return len(t.Added) == 0 && len(t.Removed) == 0
+}
+
+func diffTopology(old, top Topology) TopologyDiff {
+	diff := TopologyDiff{Added: []string{}, Removed: []string{}}
+	oldKeys := make(map[string]bool, len(old.Producers))
+	newKeys := make(map[string]bool, len(top.Producers))
+	for i := range old.Producers {
+		oldKeys[peerKey(old.Producers[i].Addr, old.Producers[i].Port)] = true
+	}
+	for i := range top.Producers {
+		k := peerKey(top.Producers[i].Addr, top.Producers[i].Port)
+		newKeys[k] = true
+		if !oldKeys[k] && !contains(diff.Added, k) {
+			diff.Added = append(diff.Added, k)
+		}
+	}
+	for k := range oldKeys {
+		if !newKeys[k] {
+			diff.Removed = append(diff.Removed, k)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func loadTopology(filePath string) (Topology, error) {
+	top := Topology{}
+	fBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return top, err
+	}
+	err = json.Unmarshal(fBytes, &top)
+	return top, err
+}
+
+// LastTopologyDiff returns the changes made by the last topology update.
+func (d *Downloader) LastTopologyDiff() TopologyDiff {
+	d.topologyMu.Lock()
+	defer d.topologyMu.Unlock()
+	return d.lastDiff
+}
+
+// updateTopology loads the topology file filePath, an empty topology when
+// it does not exist yet, and saves what update returns. topologyMu is held
+// throughout so that concurrent updates, demotions, peer file reloads and
+// regenerations, apply one after the other instead of overwriting each
+// other.
+func (d *Downloader) updateTopology(filePath string, update func(top Topology) (Topology, error)) error {
+	d.topologyMu.Lock()
+	defer d.topologyMu.Unlock()
+
+	top, err := loadTopology(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if top, err = update(top); err != nil {
+		return err
+	}
+	return d.saveTopology(filePath, top)
+}
+
+// saveTopology replaces filePath with top, topologyMu must be held. The new
+// contents are written to a temporary file that is renamed over the live
+// file, so readers never see a partial topology. The previous version is
+// kept in the same directory, with a timestamp suffix, and only the last
+// topology_history versions are retained.
+func (d *Downloader) saveTopology(filePath string, top Topology) error {
+	newBytes, err := json.MarshalIndent(&top, "", "   ")
+	if err != nil {
+		return err
+	}
+
+	oldBytes, err := ioutil.ReadFile(filePath)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if exists && bytes.Equal(oldBytes, newBytes) {
+		d.log.Debugf("topology %s did not change", filePath)
+		return nil
+	}
+
+	old := Topology{}
+	if exists {
+		if er := json.Unmarshal(oldBytes, &old); er != nil {
+			d.log.Warnf("previous topology %s is not valid json: %s", filePath, er.Error())
+		}
+	}
+
+	if err = writeFileAtomic(filePath, newBytes); err != nil {
+		return errors.Annotatef(err, "writing topology %s", filePath)
+	}
+
+	if exists && d.node.TopologyHistory > 0 {
+		if er := d.keepHistory(filePath, oldBytes); er != nil {
+			d.log.Errorf("while keeping topology history: %s", er.Error())
+		}
+	}
+
+	diff := diffTopology(old, top)
+	diff.File = filePath
+	d.lastDiff = diff
+	d.log.Infow("topology updated",
+		"node", d.node.Name,
+		"file", filePath,
+		"peers", len(top.Producers),
+		"added", diff.Added,
+		"removed", diff.Removed)
+
+	return nil
+}
+
+func (d *Downloader) keepHistory(filePath string, oldBytes []byte) error {
+	versionPath := filePath + "." + time.Now().UTC().Format(historyTimeFormat)
+	if err := writeFileAtomic(versionPath, oldBytes); err != nil {
+		return err
+	}
+
+	versions, err := filepath.Glob(filePath + ".*T*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(versions)
+	for len(versions) > int(d.node.TopologyHistory) {
+		if err = os.Remove(versions[0]); err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of
+// filePath and renames it to filePath.
+func writeFileAtomic(filePath string, data []byte) (err error) {
+	dir := filepath.Dir(filePath)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
@@ -0,0 +1,189 @@
+package cardanocfg_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+)
+
+const topologyHistoryConfig = `
+producers:
+  - pool: "test"
+    host: "producer.example.com"
+    network: "mainnet"
+    root_dir: %s
+    topology_history: 2
+relays:
+  - pool: "test"
+    host: "relay0.example.com"
+    network: "mainnet"
+    port: 3001
+`
+
+func TestTopologyHistory(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	c := newTestConfig(t, fmt.Sprintf(topologyHistoryConfig, dir))
+	node := &c.Producers[0]
+	node.IsProducer = true
+
+	d, err := cardanocfg.New(node, c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	path, err := d.GetFilePath(cardanocfg.TopologyJSON, false)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	for i := 0; i < 4; i++ {
+		node.Relays = append(node.Relays, node.Relays[0])
+		node.Relays[len(node.Relays)-1].Host = fmt.Sprintf("relay%d.example.com", i+1)
+		if !a.Nil(d.DownloadAndSetTopologyFile(context.Background())) {
+			t.FailNow()
+		}
+	}
+
+	diff := d.LastTopologyDiff()
+	a.Equal([]string{"relay4.example.com:3001"}, diff.Added)
+	a.Empty(diff.Removed)
+
+	top := cardanocfg.Topology{}
+	b, err := ioutil.ReadFile(path)
+	if !a.Nil(err) || !a.Nil(json.Unmarshal(b, &top)) {
+		t.FailNow()
+	}
+	a.Len(top.Producers, 5)
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	versions := 0
+	for _, f := range files {
+		a.False(strings.Contains(f.Name(), ".tmp"), f.Name())
+		if strings.HasPrefix(f.Name(), filepath.Base(path)+".") {
+			versions++
+		}
+	}
+	a.Equal(2, versions)
+}
+
+const concurrentUpdatesConfig = `
+relays:
+  - pool: "test"
+    host: "5.5.5.5"
+    network: "mainnet"
+    port: 3001
+    root_dir: %s
+    peer_files: [%s]
+    peer_files_interval: 1ms
+    demotion:
+      threshold: 1
+      cooldown: 1h
+`
+
+func TestConcurrentTopologyUpdates(t *testing.T) {
+	a := assert.New(t)
+
+	dir := t.TempDir()
+	peerFile := writePeerFile(t, dir, "peers.json", `{"Producers": [{"addr": "9.9.9.1", "port": 3001, "valency": 1}]}`)
+	c := newTestConfig(t, fmt.Sprintf(concurrentUpdatesConfig, dir, peerFile))
+	d, err := cardanocfg.New(&c.Relays[0], c)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	candidates := make(cardanocfg.NodeList, 8)
+	for i := range candidates {
+		candidates[i].Addr = fmt.Sprintf("1.0.0.%d", i+1)
+		candidates[i].Port = 3001
+		candidates[i].SetLatency(time.Duration(i+1) * time.Millisecond)
+	}
+	selected, err := d.SelectDiverse(candidates, 4)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	path, err := d.GetFilePath(cardanocfg.TopologyJSON, false)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	b, err := json.Marshal(cardanocfg.Topology{Producers: selected})
+	if !a.Nil(err) || !a.Nil(ioutil.WriteFile(path, b, 0o600)) {
+		t.FailNow()
+	}
+	addrs := func() []string {
+		top := cardanocfg.Topology{}
+		b, er := ioutil.ReadFile(path)
+		if !a.Nil(er) || !a.Nil(json.Unmarshal(b, &top)) {
+			t.FailNow()
+		}
+		list := make([]string, len(top.Producers))
+		for i := range top.Producers {
+			list[i] = top.Producers[i].Addr
+		}
+		return list
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.WatchPeerFiles(ctx)
+
+	// the peer files are reloaded while the selected peers are demoted
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			writePeerFile(t, dir, "peers.json",
+				fmt.Sprintf(`{"Producers": [{"addr": "9.9.9.%d", "port": 3001, "valency": 1}]}`, i%2+1))
+			time.Sleep(time.Millisecond * 2)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range selected {
+			d.PeerFailed(fmt.Sprintf("%s:3001", selected[i].Addr))
+			time.Sleep(time.Millisecond * 5)
+		}
+	}()
+	wg.Wait()
+
+	// the watcher sees changes through the mtime, whose granularity is
+	// coarser than the writes above
+	time.Sleep(time.Millisecond * 20)
+	writePeerFile(t, dir, "peers.json", `{"Producers": [{"addr": "9.9.9.3", "port": 3001, "valency": 1}]}`)
+	for i := 0; i < 100 && !contains(addrs(), "9.9.9.3"); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	cancel()
+
+	// no demotion was undone by a reload and no reload by a demotion
+	final := addrs()
+	for i := range selected {
+		a.NotContains(final, selected[i].Addr)
+	}
+	a.Contains(final, "9.9.9.3")
+	a.NotContains(final, "9.9.9.1")
+	a.NotContains(final, "9.9.9.2")
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
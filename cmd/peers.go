@@ -0,0 +1,278 @@
+/*
+Copyright © 2021 Luis Garcia
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/config"
+)
+
+var peersNodeID int
+var peersIsProducer bool
+var peersJSON bool
+var peersMethod string
+var peersLimit int
+
+// peersCmd groups the commands that inspect a node's peers
+var peersCmd = &cobra.Command{
+	Use:   "peers",
+	Short: "Inspect and troubleshoot the peers of a cardano node",
+	Long:  `Inspect and troubleshoot the peers of a cardano node, selected with the id and is-producer flags.`,
+}
+
+var peersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the candidate peers",
+	Long:  `List the candidate peers fetched from the configured sources, after the peer filters are applied.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := peersDownloader()
+		if err != nil {
+			return err
+		}
+
+		candidates, err := d.Candidates(context.Background())
+		if err != nil {
+			return err
+		}
+		if candidates, err = d.SetGeo(candidates); err != nil {
+			return err
+		}
+		return printPeers(candidates, false)
+	},
+}
+
+var peersProbeCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "Probe the candidate peers and rank them",
+	Long: `Probe the candidate peers and print them ranked by latency. The probe method
+defaults to the node's probe configuration, handshake checks that the peers
+are cardano nodes on the node's network.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := peersNode()
+		if err != nil {
+			return err
+		}
+		switch peersMethod {
+		case "":
+		case "auto", "icmp", "tcp", "udp", "handshake":
+			n.Probe.Method = peersMethod
+		default:
+			return fmt.Errorf("unknown probe method: %s", peersMethod)
+		}
+		d, err := cardanocfg.New(n, conf)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		candidates, err := d.Candidates(ctx)
+		if err != nil {
+			return err
+		}
+		if peersLimit > 0 && peersLimit < len(candidates) {
+			candidates = candidates[:peersLimit]
+		}
+
+		ranked, err := d.Rank(ctx, candidates)
+		if err != nil {
+			return err
+		}
+		ranked = d.AnalyzePaths(ctx, ranked)
+		if ranked, err = d.SetGeo(ranked); err != nil {
+			return err
+		}
+		return printPeers(ranked, true)
+	},
+}
+
+var peersTopologyCmd = &cobra.Command{
+	Use:   "topology",
+	Short: "Print the topology that would be written for the node",
+	Long: `Print the topology.json that would be written for the node, the node's
+topology file is not modified.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := peersDownloader()
+		if err != nil {
+			return err
+		}
+
+		top, err := d.BuildTopology(context.Background())
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(top, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	},
+}
+
+var peersTraceCmd = &cobra.Command{
+	Use:   "trace <addr>",
+	Short: "Trace the route to a peer",
+	Long: `Trace the route to a peer, reporting every hop, the last responding hop and,
+when a geoip_db is configured, the AS path. Tracing needs the CAP_NET_RAW capability.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := peersDownloader()
+		if err != nil {
+			return err
+		}
+
+		path, err := d.TracePeer(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HOP\tIP\tRTT\tASN\tORG\tCOUNTRY")
+		for _, h := range path.Hops {
+			asn := ""
+			if h.Geo.ASN != 0 {
+				asn = fmt.Sprintf("AS%d", h.Geo.ASN)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%v\t%s\t%s\t%s\n", h.Distance, h.IP, h.RTT, asn, h.Geo.Org, h.Geo.Country)
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println(path.String())
+		return nil
+	},
+}
+
+// peerReport is how a peer is printed by the peers commands
+type peerReport struct {
+	Rank       int     `json:"rank,omitempty"`
+	Addr       string  `json:"addr"`
+	Port       uint    `json:"port"`
+	Valency    uint    `json:"valency"`
+	Method     string  `json:"method,omitempty"`
+	AvgRttMs   float64 `json:"avg_rtt_ms,omitempty"`
+	P95RttMs   float64 `json:"p95_rtt_ms,omitempty"`
+	StdDevMs   float64 `json:"stddev_ms,omitempty"`
+	PacketLoss float64 `json:"packet_loss"`
+	ASN        uint    `json:"asn,omitempty"`
+	Org        string  `json:"org,omitempty"`
+	Country    string  `json:"country,omitempty"`
+	Hops       int     `json:"hops,omitempty"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// printPeers prints peers as a table, or as JSON with the --json flag,
+// ranked includes the probe statistics.
+func printPeers(peers cardanocfg.NodeList, ranked bool) error {
+	reports := make([]peerReport, len(peers))
+	for i := range peers {
+		p := &peers[i]
+		r := peerReport{
+			Addr:    p.Addr,
+			Port:    p.Port,
+			Valency: p.Valency,
+			ASN:     p.Geo.ASN,
+			Org:     p.Geo.Org,
+			Country: p.Geo.Country,
+		}
+		if ranked {
+			r.Rank = i + 1
+			r.Method = string(p.Stats.Method)
+			r.AvgRttMs = ms(p.Stats.AvgRtt)
+			r.P95RttMs = ms(p.Stats.P95Rtt)
+			r.StdDevMs = ms(p.Stats.StdDevRtt)
+			r.PacketLoss = p.Stats.PacketLoss
+		}
+		if p.Path != nil {
+			r.Hops = p.Path.HopCount
+		}
+		reports[i] = r
+	}
+
+	if peersJSON {
+		b, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if ranked {
+		fmt.Fprintln(w, "RANK\tADDR\tPORT\tMETHOD\tAVG MS\tP95 MS\tSTDDEV MS\tLOSS %\tASN\tCOUNTRY\tHOPS")
+		for _, r := range reports {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%.2f\t%.2f\t%.2f\t%.1f\t%d\t%s\t%d\n",
+				r.Rank, r.Addr, r.Port, r.Method, r.AvgRttMs, r.P95RttMs, r.StdDevMs, r.PacketLoss, r.ASN, r.Country, r.Hops)
+		}
+		return w.Flush()
+	}
+	fmt.Fprintln(w, "ADDR\tPORT\tVALENCY\tASN\tORG\tCOUNTRY")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", r.Addr, r.Port, r.Valency, r.ASN, r.Org, r.Country)
+	}
+	return w.Flush()
+}
+
+// peersNode returns the configuration of the node selected by the peers
+// flags.
+func peersNode() (*config.Node, error) {
+	if peersIsProducer {
+		if peersNodeID < 0 || peersNodeID >= len(conf.Producers) {
+			return nil, fmt.Errorf("there is no producer with ID: %d", peersNodeID)
+		}
+		return &conf.Producers[peersNodeID], nil
+	}
+	if peersNodeID < 0 || peersNodeID >= len(conf.Relays) {
+		return nil, fmt.Errorf("there is no relay with ID: %d", peersNodeID)
+	}
+	return &conf.Relays[peersNodeID], nil
+}
+
+func peersDownloader() (*cardanocfg.Downloader, error) {
+	n, err := peersNode()
+	if err != nil {
+		return nil, err
+	}
+	return cardanocfg.New(n, conf)
+}
+
+func init() {
+	rootCmd.AddCommand(peersCmd)
+	peersCmd.AddCommand(peersListCmd)
+	peersCmd.AddCommand(peersProbeCmd)
+	peersCmd.AddCommand(peersTopologyCmd)
+	peersCmd.AddCommand(peersTraceCmd)
+
+	peersCmd.PersistentFlags().IntVarP(&peersNodeID, "id", "i", 0, "relay id")
+	peersCmd.PersistentFlags().BoolVarP(&peersIsProducer, "is-producer", "p", false, "selects a producer instead of a relay")
+	peersCmd.PersistentFlags().BoolVar(&peersJSON, "json", false, "prints JSON instead of a table")
+
+	peersProbeCmd.Flags().StringVarP(&peersMethod, "method", "m", "", "probe method: auto, icmp, tcp, udp or handshake")
+	peersProbeCmd.Flags().IntVarP(&peersLimit, "limit", "l", 0, "probes only the first limit candidates")
+}
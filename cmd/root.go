@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/adakailabs/gocnode/config"
@@ -44,7 +45,9 @@ to quickly create a Cobra application.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(exitCode(err))
+	}
 }
 
 func init() {
@@ -69,6 +72,5 @@ func initConfig() {
 			time.Sleep(time.Second * 10)
 			fmt.Println("config not found: ", cfgFile, err.Error())
 		}
-		panic(err.Error())
 	}
 }
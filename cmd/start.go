@@ -16,7 +16,15 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/juju/errors"
+
 	"github.com/adakailabs/gocnode/runner/node"
+	"github.com/adakailabs/gocnode/runner/process"
 	"github.com/adakailabs/gocnode/runner/prometheuscfg"
 	"github.com/adakailabs/gocnode/runner/rtview"
 	"github.com/spf13/cobra"
@@ -27,6 +35,29 @@ var isProducer bool
 var passive bool
 var logMinSeverity string
 
+// Exit codes of the start commands, a clean shutdown exits with 0
+const (
+	// exitFailure is used when gocnode could not start or a process was
+	// crash looping
+	exitFailure = 1
+	// exitKilled is used when a process did not stop within its grace
+	// period and was killed
+	exitKilled = 2
+)
+
+func exitCode(err error) int {
+	if errors.Cause(err) == process.ErrKilled {
+		return exitKilled
+	}
+	return exitFailure
+}
+
+// signalContext returns a context that is done when gocnode gets SIGINT or
+// SIGTERM, the runners then stop their processes gracefully.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
 // startNodeCmd represents the start command
 var startNodeCmd = &cobra.Command{
 	Use:   "start-node",
@@ -42,7 +73,9 @@ var startNodeCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return r.StartCnode()
+		ctx, stop := signalContext()
+		defer stop()
+		return r.StartCnode(ctx)
 	},
 }
 
@@ -60,7 +93,9 @@ var startOptimizer = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return r.StartCnode()
+		ctx, stop := signalContext()
+		defer stop()
+		return r.StartCnode(ctx)
 	},
 }
 
@@ -74,7 +109,9 @@ var startPrometheus = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return r.StartPrometheus()
+		ctx, stop := signalContext()
+		defer stop()
+		return r.StartPrometheus(ctx)
 	},
 }
 
@@ -88,7 +125,9 @@ var startRTView = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return r.StartRtView()
+		ctx, stop := signalContext()
+		defer stop()
+		return r.StartRtView(ctx)
 	},
 }
 
@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"time"
 
 	l "github.com/adakailabs/gocnode/logger"
 	"github.com/juju/errors"
@@ -13,8 +15,17 @@ import (
 
 const testnet = "testnet"
 
+// IP families a node can use for its topology
+const (
+	IPv4      = "ipv4"
+	IPv6      = "ipv6"
+	DualStack = "dual"
+)
+
 const PrometheusConfigPath = "/home/lovelace/prometheus/"
 
+const ConfigURI = "https://hydra.iohk.io/job/Cardano/cardano-node/cardano-deployment/latest-finished/download/1"
+
 var RelaysHostsList map[string][]NodeShort
 var ProducerHostsList map[string][]NodeShort
 
@@ -52,6 +63,398 @@ type Node struct {
 
 	LogMinSeverity    string `mapstructure:"log_min_severity"`
 	FilterMinSeverity string `mapstructure:"filter_min_severity"`
+
+	Diversity  Diversity  `mapstructure:"diversity"`
+	PeerFilter PeerFilter `mapstructure:"peer_filter"`
+	Demotion   Demotion   `mapstructure:"demotion"`
+
+	// IPFamily is one of ipv4 (default), ipv6 or dual
+	IPFamily string `mapstructure:"ip_family"`
+
+	// TopologyHistory is the number of previous topology files kept
+	TopologyHistory uint `mapstructure:"topology_history"`
+
+	Probe Probe `mapstructure:"probe"`
+
+	PathAnalysis PathAnalysis `mapstructure:"path_analysis"`
+
+	TopologyPolicy TopologyPolicy `mapstructure:"topology_policy"`
+
+	// PeerFiles are curated peer files, in the legacy or P2P topology
+	// format, merged into the topology with priority over discovered peers
+	PeerFiles         []string      `mapstructure:"peer_files"`
+	PeerFilesInterval time.Duration `mapstructure:"peer_files_interval"`
+
+	// LogFiles writes the raw output of the node's services to rotated
+	// files, dir defaults to <root_dir>/logs
+	LogFiles LogFiles `mapstructure:"log_files"`
+
+	Health Health `mapstructure:"health"`
+
+	Watchdog Watchdog `mapstructure:"watchdog"`
+
+	// Services override how cardano-node and node_exporter are run and
+	// declare the other services of the node
+	Services map[string]ServiceExec `mapstructure:"services"`
+	// RTSOptions are GHC runtime options of cardano-node, such as -N2,
+	// -A16m or --nonmoving-gc, cardano-node must be built with -rtsopts
+	// for most of them
+	RTSOptions []string `mapstructure:"rts_options"`
+}
+
+// Behaviors of the topology policy when too few discovered peers qualify
+const (
+	InsufficientFail   = "fail"
+	InsufficientWarn   = "warn"
+	InsufficientCached = "cached"
+)
+
+// TopologyPolicy sets how many peers of each category a relay's topology
+// gets. Internal peers, the pool's producers and the ext_producer entries,
+// are always included unless omit_internal is set, pinned and curated peers
+// are always included. Discovered peers are selected from max_discovered *
+// oversampling probed candidates, when fewer than min_discovered qualify
+// the topology generation fails, warns and goes on, or reuses the
+// discovered peers of the cached topology, following insufficient.
+type TopologyPolicy struct {
+	MinDiscovered uint    `mapstructure:"min_discovered"`
+	MaxDiscovered uint    `mapstructure:"max_discovered"`
+	OmitInternal  bool    `mapstructure:"omit_internal"`
+	Oversampling  float64 `mapstructure:"oversampling"`
+	Insufficient  string  `mapstructure:"insufficient"`
+}
+
+// PathAnalysis configures the optional traceroute of the best candidate
+// peers, peers with shorter paths through different transit networks are
+// preferred. Tracing needs the CAP_NET_RAW capability.
+type PathAnalysis struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Candidates is the number of lowest latency peers traced
+	Candidates uint          `mapstructure:"candidates"`
+	MaxHops    uint          `mapstructure:"max_hops"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// Probe limits how candidate peers are probed: how many at the same time,
+// for how long each and the deadline for the whole run.
+type Probe struct {
+	Parallelism uint          `mapstructure:"parallelism"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	Deadline    time.Duration `mapstructure:"deadline"`
+	// Method is auto, icmp, tcp, udp or handshake, auto uses icmp when the
+	// process is allowed to send it and Fallback otherwise
+	Method   string `mapstructure:"method"`
+	Fallback string `mapstructure:"fallback"`
+	// Count, Size, Interval and SampleTimeout configure the samples taken
+	// from each peer
+	Count         uint          `mapstructure:"count"`
+	Size          uint          `mapstructure:"size"`
+	Interval      time.Duration `mapstructure:"interval"`
+	SampleTimeout time.Duration `mapstructure:"sample_timeout"`
+	// MaxPacketLoss is the percentage of lost samples tolerated before a
+	// peer is dropped
+	MaxPacketLoss float64 `mapstructure:"max_packet_loss"`
+}
+
+// validate sets the policy defaults: max_discovered defaults to the node's
+// peers, or 10, min_discovered to 1, oversampling to 3 and insufficient to
+// warn.
+func (p *TopologyPolicy) validate(n *Node) error {
+	if p.MaxDiscovered == 0 {
+		p.MaxDiscovered = n.Peers
+	}
+	if p.MaxDiscovered == 0 {
+		p.MaxDiscovered = 10
+	}
+	if p.MinDiscovered == 0 {
+		p.MinDiscovered = 1
+	}
+	if p.MinDiscovered > p.MaxDiscovered {
+		return fmt.Errorf("node %s: topology_policy min_discovered (%d) is greater than max_discovered (%d)",
+			n.Name, p.MinDiscovered, p.MaxDiscovered)
+	}
+	if p.Oversampling == 0 {
+		p.Oversampling = 3
+	}
+	if p.Oversampling < 1 {
+		return fmt.Errorf("node %s: topology_policy oversampling must be at least 1, got: %v", n.Name, p.Oversampling)
+	}
+	switch p.Insufficient {
+	case "":
+		p.Insufficient = InsufficientWarn
+	case InsufficientFail, InsufficientWarn, InsufficientCached:
+	default:
+		return fmt.Errorf("node %s: topology_policy insufficient must be one of %s, %s or %s, got: %s",
+			n.Name, InsufficientFail, InsufficientWarn, InsufficientCached, p.Insufficient)
+	}
+	return nil
+}
+
+// AllowsIP reports whether ip belongs to one of the node's IP families.
+func (n *Node) AllowsIP(ip net.IP) bool {
+	isV4 := ip.To4() != nil
+	switch n.IPFamily {
+	case IPv6:
+		return !isV4
+	case DualStack:
+		return true
+	default:
+		return isV4
+	}
+}
+
+// Demotion configures when a peer that cardano-node reports as failing is
+// removed from the topology, and for how long it is kept out of it.
+// cardano-node reads its topology file when it starts, a demoted peer is
+// dropped from its connections on its next start.
+type Demotion struct {
+	Disabled  bool          `mapstructure:"disabled"`
+	Threshold uint          `mapstructure:"threshold"`
+	Window    time.Duration `mapstructure:"window"`
+	Cooldown  time.Duration `mapstructure:"cooldown"`
+}
+
+// PeerFilter lists the peers a node must never use (Block), the only
+// discovered peers it may use (Allow, when not empty) and the peers it must
+// always use (Pinned). Allow and Block entries may be hostnames, globs such
+// as "*.example.com", IP addresses or CIDRs.
+type PeerFilter struct {
+	Allow  []string    `mapstructure:"allow"`
+	Block  []string    `mapstructure:"block"`
+	Pinned []NodeShort `mapstructure:"pinned"`
+}
+
+func (f *PeerFilter) merge(o PeerFilter) {
+	f.Allow = append(f.Allow, o.Allow...)
+	f.Block = append(f.Block, o.Block...)
+	f.Pinned = append(f.Pinned, o.Pinned...)
+}
+
+// HTTP configures the client used to download configuration files and
+// peer lists.
+type HTTP struct {
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Retries is how many times a failed request is retried, 3 when not
+	// set, 0 disables retries
+	Retries *uint         `mapstructure:"retries"`
+	Backoff time.Duration `mapstructure:"backoff"`
+	Proxy   string        `mapstructure:"proxy"`
+	CAFile  string        `mapstructure:"ca_file"`
+}
+
+// Restart policies of the supervised services
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// Supervisor configures how the child processes are restarted. Policies
+// maps a service name (cardano-node, node_exporter, topology_updater,
+// prometheus, rtview) to its restart policy. Restarts wait an exponential
+// backoff from initial_backoff to max_backoff, a service that fails
+// max_restarts times within window is considered crash looping and the
+// supervisor gives up. The readiness checks of the services are run every
+// ready_interval.
+type Supervisor struct {
+	Policies       map[string]string `mapstructure:"policies"`
+	InitialBackoff time.Duration     `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration     `mapstructure:"max_backoff"`
+	MaxRestarts    uint              `mapstructure:"max_restarts"`
+	Window         time.Duration     `mapstructure:"window"`
+	ReadyInterval  time.Duration     `mapstructure:"ready_interval"`
+}
+
+func (s *Supervisor) validate() error {
+	if s.InitialBackoff == 0 {
+		s.InitialBackoff = time.Second
+	}
+	if s.MaxBackoff == 0 {
+		s.MaxBackoff = time.Minute * 5
+	}
+	if s.MaxBackoff < s.InitialBackoff {
+		return fmt.Errorf("supervisor max_backoff (%v) is lower than initial_backoff (%v)", s.MaxBackoff, s.InitialBackoff)
+	}
+	if s.MaxRestarts == 0 {
+		s.MaxRestarts = 5
+	}
+	if s.Window == 0 {
+		s.Window = time.Minute * 10
+	}
+	if s.ReadyInterval == 0 {
+		s.ReadyInterval = time.Second
+	}
+	for name, p := range s.Policies {
+		switch p {
+		case RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			return fmt.Errorf("supervisor policy of %s must be one of %s, %s or %s, got: %s",
+				name, RestartAlways, RestartOnFailure, RestartNever, p)
+		}
+	}
+	return nil
+}
+
+// Shutdown configures how long the child processes are given to exit
+// cleanly when gocnode stops: cardano-node gets SIGINT and grace_period,
+// the other processes SIGTERM and sidecar_grace_period. Processes still
+// running after their grace period are killed.
+type Shutdown struct {
+	GracePeriod        time.Duration `mapstructure:"grace_period"`
+	SidecarGracePeriod time.Duration `mapstructure:"sidecar_grace_period"`
+}
+
+// Health configures the /healthz and /readyz endpoints of a node, served
+// on port. The chain tip is read from metrics_url every scrape_interval.
+// /healthz fails when cardano-node is not running or it or node_exporter
+// gave up, and, once startup_grace has passed since cardano-node started,
+// when the node socket is missing or the metrics endpoint does not answer
+// within metrics_timeout. /readyz also fails when the tip did not advance
+// for max_tip_age.
+type Health struct {
+	Port           uint          `mapstructure:"port"`
+	MetricsURL     string        `mapstructure:"metrics_url"`
+	ScrapeInterval time.Duration `mapstructure:"scrape_interval"`
+	MetricsTimeout time.Duration `mapstructure:"metrics_timeout"`
+	StartupGrace   time.Duration `mapstructure:"startup_grace"`
+	MaxTipAge      time.Duration `mapstructure:"max_tip_age"`
+}
+
+func (h *Health) validate() {
+	if h.Port == 0 {
+		h.Port = 12800
+	}
+	if h.MetricsURL == "" {
+		h.MetricsURL = "http://127.0.0.1:12798/metrics"
+	}
+	if h.ScrapeInterval == 0 {
+		h.ScrapeInterval = time.Second * 10
+	}
+	if h.MetricsTimeout == 0 {
+		h.MetricsTimeout = time.Second * 2
+	}
+	if h.StartupGrace == 0 {
+		h.StartupGrace = time.Minute * 10
+	}
+	if h.MaxTipAge == 0 {
+		h.MaxTipAge = time.Minute * 5
+	}
+}
+
+// Watchdog configures the chain tip stall watchdog of a node. The tip is
+// checked every check_interval, when it did not advance for stall_after an
+// alert is logged, and posted to alert_webhook when set, after
+// regenerate_after the topology is regenerated and cardano-node restarted to
+// load it, and after restart_after cardano-node is restarted again. An action is not taken again before
+// min_action_interval, every action is appended to record_file, which
+// defaults to <root_dir>/watchdog.jsonl, and the last history actions are
+// kept in memory.
+type Watchdog struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	StallAfter      time.Duration `mapstructure:"stall_after"`
+	RegenerateAfter time.Duration `mapstructure:"regenerate_after"`
+	RestartAfter    time.Duration `mapstructure:"restart_after"`
+	MinInterval     time.Duration `mapstructure:"min_action_interval"`
+	CheckInterval   time.Duration `mapstructure:"check_interval"`
+	AlertWebhook    string        `mapstructure:"alert_webhook"`
+	History         uint          `mapstructure:"history"`
+	RecordFile      string        `mapstructure:"record_file"`
+}
+
+func (w *Watchdog) validate(rootDir string) error {
+	if w.StallAfter == 0 {
+		w.StallAfter = time.Minute * 10
+	}
+	if w.RegenerateAfter == 0 {
+		w.RegenerateAfter = time.Minute * 20
+	}
+	if w.RestartAfter == 0 {
+		w.RestartAfter = time.Minute * 30
+	}
+	if w.MinInterval == 0 {
+		w.MinInterval = time.Minute * 30
+	}
+	if w.CheckInterval == 0 {
+		w.CheckInterval = time.Second * 30
+	}
+	if w.History == 0 {
+		w.History = 50
+	}
+	if w.RecordFile == "" {
+		w.RecordFile = fmt.Sprintf("%s/watchdog.jsonl", rootDir)
+	}
+	if w.StallAfter > w.RegenerateAfter || w.RegenerateAfter > w.RestartAfter {
+		return fmt.Errorf("watchdog: stall_after (%v) <= regenerate_after (%v) <= restart_after (%v) does not hold",
+			w.StallAfter, w.RegenerateAfter, w.RestartAfter)
+	}
+	return nil
+}
+
+// LogFiles configures the files the raw output of the services is written
+// to, <dir>/<service>.log, independently of the log rules. Services lists
+// the services that get a file, all of them when empty. Files are rotated
+// when they reach max_size_mb or max_age, rotated files are gzipped with
+// compress and removed when there are more than max_backups or they are
+// older than retention.
+type LogFiles struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Dir        string        `mapstructure:"dir"`
+	Services   []string      `mapstructure:"services"`
+	MaxSizeMB  uint          `mapstructure:"max_size_mb"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+	MaxBackups uint          `mapstructure:"max_backups"`
+	Retention  time.Duration `mapstructure:"retention"`
+	Compress   bool          `mapstructure:"compress"`
+}
+
+// ForService reports whether service writes its output to a file.
+func (lf *LogFiles) ForService(service string) bool {
+	if !lf.Enabled {
+		return false
+	}
+	if len(lf.Services) == 0 {
+		return true
+	}
+	for _, s := range lf.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+func (lf *LogFiles) validate(defaultDir string) error {
+	if !lf.Enabled {
+		return nil
+	}
+	if lf.Dir == "" {
+		lf.Dir = defaultDir
+	}
+	if lf.Dir == "" {
+		return fmt.Errorf("log_files needs a dir")
+	}
+	if lf.MaxSizeMB == 0 {
+		lf.MaxSizeMB = 100
+	}
+	if lf.MaxAge == 0 {
+		lf.MaxAge = time.Hour * 24
+	}
+	if lf.MaxBackups == 0 {
+		lf.MaxBackups = 7
+	}
+	return nil
+}
+
+// Diversity holds the geographic and network diversity rules applied when
+// selecting external peers. A zero value disables the corresponding rule.
+type Diversity struct {
+	MaxPerASN     uint `mapstructure:"max_per_asn"`
+	MaxPerCountry uint `mapstructure:"max_per_country"`
+	MinContinents uint `mapstructure:"min_continents"`
+}
+
+func (d Diversity) Enabled() bool {
+	return d.MaxPerASN > 0 || d.MaxPerCountry > 0 || d.MinContinents > 0
 }
 
 type Mapped struct {
@@ -66,6 +469,32 @@ type Mapped struct {
 	Relays          []Node `mapstructure:"relays"`
 	RelaysHostsList map[string][]NodeShort
 
+	GeoIPDB string `mapstructure:"geoip_db"`
+
+	// PeerFilters are applied to every node of the network used as key
+	PeerFilters map[string]PeerFilter `mapstructure:"peer_filters"`
+
+	HTTP HTTP `mapstructure:"http"`
+
+	Supervisor Supervisor `mapstructure:"supervisor"`
+
+	Shutdown Shutdown `mapstructure:"shutdown"`
+
+	// LogRules route the output of the services, keyed by service name
+	LogRules         map[string][]LogRule `mapstructure:"log_rules"`
+	LogRulesInterval time.Duration        `mapstructure:"log_rules_interval"`
+
+	// LogFiles configures the output files of prometheus and rtview
+	LogFiles LogFiles `mapstructure:"log_files"`
+
+	// Services override how prometheus and rtview are run and declare
+	// other services run with them
+	Services map[string]ServiceExec `mapstructure:"services"`
+
+	// ConfigURI is where the cardano-node configuration files are
+	// downloaded from
+	ConfigURI string `mapstructure:"config_uri"`
+
 	PrometheusConfigPath string
 }
 
@@ -115,6 +544,51 @@ func New(configFile string, testmode bool, logLevel string) (c *C, err error) {
 		m.MainnetRTPortBase = 6000
 	}
 
+	if m.ConfigURI == "" {
+		m.ConfigURI = ConfigURI
+	}
+
+	if m.HTTP.Timeout == 0 {
+		m.HTTP.Timeout = time.Second * 60
+	}
+
+	if m.HTTP.Retries == nil {
+		retries := uint(3)
+		m.HTTP.Retries = &retries
+	}
+
+	if m.HTTP.Backoff == 0 {
+		m.HTTP.Backoff = time.Second * 2
+	}
+
+	if m.Shutdown.GracePeriod == 0 {
+		m.Shutdown.GracePeriod = time.Minute
+	}
+
+	if m.Shutdown.SidecarGracePeriod == 0 {
+		m.Shutdown.SidecarGracePeriod = time.Second * 10
+	}
+
+	if m.LogRulesInterval == 0 {
+		m.LogRulesInterval = time.Second * 30
+	}
+
+	if m.LogRules, err = validateLogRules(m.LogRules); err != nil {
+		return nil, err
+	}
+
+	if err = m.LogFiles.validate(""); err != nil {
+		return nil, err
+	}
+
+	if err = validateServices(m.Services, []string{ServicePrometheus, ServiceRtView}); err != nil {
+		return nil, err
+	}
+
+	if err = m.Supervisor.validate(); err != nil {
+		return nil, err
+	}
+
 	ProducerHostsList = make(map[string][]NodeShort)
 	RelaysHostsList = make(map[string][]NodeShort)
 	m.PrometheusConfigPath = PrometheusConfigPath
@@ -123,6 +597,10 @@ func New(configFile string, testmode bool, logLevel string) (c *C, err error) {
 
 	c.configNodes()
 
+	if err = c.validateNodes(); err != nil {
+		return nil, err
+	}
+
 	_ = c.log.Sync()
 
 	c.latencyMap = make(map[string]Node)
@@ -175,6 +653,102 @@ func (c *C) configViper(configFile string) error {
 	return nil
 }
 
+func (c *C) validateNodes() error {
+	nodes := make([]*Node, 0, len(c.Mapped.Producers)+len(c.Mapped.Relays))
+	for i := range c.Mapped.Producers {
+		nodes = append(nodes, &c.Mapped.Producers[i])
+	}
+	for i := range c.Mapped.Relays {
+		nodes = append(nodes, &c.Mapped.Relays[i])
+	}
+
+	for _, n := range nodes {
+		if n.TopologyHistory == 0 {
+			n.TopologyHistory = 5
+		}
+		if n.Probe.Parallelism == 0 {
+			n.Probe.Parallelism = 16
+		}
+		if n.Probe.Timeout == 0 {
+			n.Probe.Timeout = time.Second * 10
+		}
+		if n.Probe.Deadline == 0 {
+			n.Probe.Deadline = time.Second * 60
+		}
+		if err := n.TopologyPolicy.validate(n); err != nil {
+			return err
+		}
+		if n.PeerFilesInterval == 0 {
+			n.PeerFilesInterval = time.Second * 30
+		}
+		n.Health.validate()
+		if err := n.Watchdog.validate(n.RootDir); err != nil {
+			return errors.Annotatef(err, "node %s", n.Name)
+		}
+		if err := validateServices(n.Services, NodeServices); err != nil {
+			return errors.Annotatef(err, "node %s", n.Name)
+		}
+		if err := validateRTSOptions(n.RTSOptions); err != nil {
+			return errors.Annotatef(err, "node %s", n.Name)
+		}
+		if err := n.LogFiles.validate(fmt.Sprintf("%s/logs", n.RootDir)); err != nil {
+			return errors.Annotatef(err, "node %s", n.Name)
+		}
+		if n.PathAnalysis.Candidates == 0 {
+			n.PathAnalysis.Candidates = 10
+		}
+		if n.PathAnalysis.MaxHops == 0 {
+			n.PathAnalysis.MaxHops = 30
+		}
+		if n.PathAnalysis.Timeout == 0 {
+			n.PathAnalysis.Timeout = time.Second * 2
+		}
+		if n.Probe.Count == 0 {
+			n.Probe.Count = 5
+		}
+		if n.Probe.Size == 0 {
+			n.Probe.Size = 128
+		}
+		if n.Probe.Interval == 0 {
+			n.Probe.Interval = time.Millisecond * 200
+		}
+		if n.Probe.SampleTimeout == 0 {
+			n.Probe.SampleTimeout = time.Second * 2
+		}
+		if n.Probe.MaxPacketLoss < 0 || n.Probe.MaxPacketLoss >= 100 {
+			return fmt.Errorf("node %s: probe max_packet_loss must be in [0, 100), got: %v",
+				n.Name, n.Probe.MaxPacketLoss)
+		}
+		if n.Probe.Method == "" {
+			n.Probe.Method = "auto"
+		}
+		if n.Probe.Fallback == "" {
+			n.Probe.Fallback = "tcp"
+		}
+		switch n.Probe.Method {
+		case "auto", "icmp", "tcp", "udp", "handshake":
+		default:
+			return fmt.Errorf("node %s: probe method must be one of auto, icmp, tcp, udp or handshake, got: %s",
+				n.Name, n.Probe.Method)
+		}
+		switch n.Probe.Fallback {
+		case "tcp", "udp":
+		default:
+			return fmt.Errorf("node %s: probe fallback must be tcp or udp, got: %s",
+				n.Name, n.Probe.Fallback)
+		}
+		switch n.IPFamily {
+		case "":
+			n.IPFamily = IPv4
+		case IPv4, IPv6, DualStack:
+		default:
+			return fmt.Errorf("node %s: ip_family must be one of %s, %s or %s, got: %s",
+				n.Name, IPv4, IPv6, DualStack, n.IPFamily)
+		}
+	}
+	return nil
+}
+
 func (c *C) LogLevel() string {
 	return c.logLevel
 }
@@ -249,6 +823,16 @@ func (c *C) configNodes() {
 			c.log.Warnf("for node %s setting prometheus node exporter port to: %d", c.Mapped.Relays[i].Name, c.Mapped.Relays[i].PromeNExpPort)
 		}
 
+		if c.Mapped.Relays[i].Demotion.Threshold == 0 {
+			c.Mapped.Relays[i].Demotion.Threshold = 5
+		}
+		if c.Mapped.Relays[i].Demotion.Window == 0 {
+			c.Mapped.Relays[i].Demotion.Window = time.Hour
+		}
+		if c.Mapped.Relays[i].Demotion.Cooldown == 0 {
+			c.Mapped.Relays[i].Demotion.Cooldown = time.Hour * 6
+		}
+
 		pool, ok := RelaysHostsList[c.Mapped.Relays[i].Pool]
 		if !ok {
 			pool = make([]NodeShort, 0, 5)
@@ -277,6 +861,14 @@ func (c *C) configNodes() {
 		c.Mapped.Relays[i].Producers = append(c.Mapped.Relays[i].Producers, c.Mapped.Relays[i].ExtProducer...)
 	}
 
+	for i := range c.Mapped.Producers {
+		c.Mapped.Producers[i].PeerFilter.merge(c.Mapped.PeerFilters[c.Mapped.Producers[i].Network])
+	}
+
+	for i := range c.Mapped.Relays {
+		c.Mapped.Relays[i].PeerFilter.merge(c.Mapped.PeerFilters[c.Mapped.Relays[i].Network])
+	}
+
 	for i := range c.Mapped.Producers {
 		const rootDir = "/home/lovelace/cardano-node"
 		if c.Mapped.Producers[i].RootDir == "" {
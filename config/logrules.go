@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/spf13/viper"
+
+	"github.com/adakailabs/gocnode/nodelog"
+)
+
+// Actions of a log rule
+const (
+	LogDrop  = "drop"
+	LogPrint = "print"
+	LogFile  = "file"
+	LogCount = "count"
+)
+
+// LogRule decides what happens to the lines a service writes. A line
+// matches a rule when it matches all of the rule's conditions: its event
+// namespace is namespace or below it, its severity is within min_severity
+// and max_severity and match, a regular expression, matches the line.
+// Namespace and severity conditions only match lines cardano-node's log
+// format. The first matching rule applies its action, lines that match no
+// rule are printed.
+type LogRule struct {
+	// Name identifies the rule in the counters, it defaults to the rule's
+	// position
+	Name        string `mapstructure:"name"`
+	Namespace   string `mapstructure:"namespace"`
+	MinSeverity string `mapstructure:"min_severity"`
+	MaxSeverity string `mapstructure:"max_severity"`
+	Match       string `mapstructure:"match"`
+	Action      string `mapstructure:"action"`
+	// File is where the file action writes the lines, it is rotated at
+	// 100MB and its 7 last backups are kept gzipped
+	File string `mapstructure:"file"`
+}
+
+// DefaultLogRules are the rules of the services that have none configured.
+var DefaultLogRules = map[string][]LogRule{
+	"cardano-node": {
+		{Name: "block_fetch_client", Namespace: "cardano.node.BlockFetchClient", Action: LogDrop},
+		{Name: "block_fetch_decision", Namespace: "cardano.node.BlockFetchDecision", Action: LogDrop},
+		{Name: "email", Match: "Email cannot be sent", Action: LogDrop},
+	},
+}
+
+func (r *LogRule) validate(service string, i int) error {
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("%s[%d]", service, i)
+	}
+	switch r.Action {
+	case "":
+		r.Action = LogPrint
+	case LogDrop, LogPrint, LogCount:
+	case LogFile:
+		if r.File == "" {
+			return fmt.Errorf("log rule %s: the file action needs a file", r.Name)
+		}
+	default:
+		return fmt.Errorf("log rule %s: action must be one of %s, %s, %s or %s, got: %s",
+			r.Name, LogDrop, LogPrint, LogFile, LogCount, r.Action)
+	}
+	for _, sev := range []string{r.MinSeverity, r.MaxSeverity} {
+		if sev == "" {
+			continue
+		}
+		if _, err := nodelog.ParseSeverity(sev); err != nil {
+			return errors.Annotatef(err, "log rule %s", r.Name)
+		}
+	}
+	if _, err := regexp.Compile(r.Match); err != nil {
+		return errors.Annotatef(err, "log rule %s", r.Name)
+	}
+	return nil
+}
+
+// validateLogRules sets the default rules of the services that have none
+// and validates every rule.
+func validateLogRules(rules map[string][]LogRule) (map[string][]LogRule, error) {
+	if rules == nil {
+		rules = make(map[string][]LogRule)
+	}
+	for service, defaults := range DefaultLogRules {
+		if _, ok := rules[service]; !ok {
+			rules[service] = append([]LogRule(nil), defaults...)
+		}
+	}
+	for service, rs := range rules {
+		for i := range rs {
+			if err := rs[i].validate(service, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rules, nil
+}
+
+// WatchLogRules checks the config file every log_rules_interval and, when it
+// changed, calls apply with its log rules. Invalid rules are reported and
+// not applied. WatchLogRules returns when ctx is done.
+func (c *C) WatchLogRules(ctx context.Context, apply func(rules map[string][]LogRule)) {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return
+	}
+	modTime := func() time.Time {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+
+	ticker := time.NewTicker(c.LogRulesInterval)
+	defer ticker.Stop()
+	last := modTime()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mt := modTime()
+		if mt.Equal(last) {
+			continue
+		}
+		last = mt
+
+		v := viper.New()
+		v.SetConfigFile(file)
+		m := Mapped{}
+		if err := v.ReadInConfig(); err != nil {
+			c.log.Errorf("log rules not reloaded: %s", err.Error())
+			continue
+		}
+		if err := v.Unmarshal(&m); err != nil {
+			c.log.Errorf("log rules not reloaded: %s", err.Error())
+			continue
+		}
+		rules, err := validateLogRules(m.LogRules)
+		if err != nil {
+			c.log.Errorf("log rules not reloaded: %s", err.Error())
+			continue
+		}
+		c.log.Info("config file changed, reloading log rules")
+		apply(rules)
+	}
+}
@@ -0,0 +1,68 @@
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+const logRulesConfig = `
+log_rules_interval: 10ms
+log_rules:
+  node_exporter:
+    - match: "level=debug"
+      action: %s
+`
+
+func writeConfig(t *testing.T, path, action string) {
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(logRulesConfig, action)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogRules(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "gocnode.yaml")
+
+	writeConfig(t, path, "fail")
+	_, err := config.New(path, true, "debug")
+	a.NotNil(err)
+
+	writeConfig(t, path, "drop")
+	c, err := config.New(path, true, "debug")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(config.DefaultLogRules["cardano-node"], c.LogRules["cardano-node"])
+	if !a.Len(c.LogRules["node_exporter"], 1) {
+		t.FailNow()
+	}
+	a.Equal("node_exporter[0]", c.LogRules["node_exporter"][0].Name)
+	a.Equal(config.LogDrop, c.LogRules["node_exporter"][0].Action)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan map[string][]config.LogRule, 2)
+	go c.WatchLogRules(ctx, func(rules map[string][]config.LogRule) { reloaded <- rules })
+
+	// invalid rules are not applied
+	time.Sleep(time.Millisecond * 50)
+	writeConfig(t, path, "fail")
+	time.Sleep(time.Millisecond * 50)
+	writeConfig(t, path, "count")
+
+	select {
+	case rules := <-reloaded:
+		a.Equal(config.LogCount, rules["node_exporter"][0].Action)
+	case <-time.After(time.Second * 5):
+		t.Fatal("log rules not reloaded")
+	}
+	a.Len(reloaded, 0)
+}
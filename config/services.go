@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the services run by gocnode
+const (
+	ServiceCardanoNode  = "cardano-node"
+	ServiceNodeExporter = "node_exporter"
+	ServicePrometheus   = "prometheus"
+	ServiceRtView       = "rtview"
+)
+
+// NodeServices are the services a node runs, they are configured in the
+// services of the node. The other services are configured in the top
+// level services.
+var NodeServices = []string{ServiceCardanoNode, ServiceNodeExporter}
+
+// allServices are the services gocnode runs, in a node or not.
+var allServices = []string{ServiceCardanoNode, ServiceNodeExporter, ServicePrometheus, ServiceRtView}
+
+// ServiceExec overrides how a service is run, or declares a new service
+// when its name is not one of the services gocnode runs. path is the
+// executable, by default the service's name looked up in PATH, extra_args
+// are appended to the arguments set by gocnode, env are KEY=value
+// variables added to the environment of gocnode and dir is the working
+// directory. New services also set their args, the services they depend
+// on, deps, and how they are found ready.
+type ServiceExec struct {
+	Path      string       `mapstructure:"path"`
+	Args      []string     `mapstructure:"args"`
+	ExtraArgs []string     `mapstructure:"extra_args"`
+	Env       []string     `mapstructure:"env"`
+	Dir       string       `mapstructure:"dir"`
+	Deps      []string     `mapstructure:"deps"`
+	Ready     ServiceReady `mapstructure:"ready"`
+}
+
+// ServiceReady is how a declared service is found ready: once file exists,
+// once tcp, host:port, accepts connections or once http answers a GET with
+// a 2xx status. At most one of them is set, a service without any is ready
+// once started.
+type ServiceReady struct {
+	File string `mapstructure:"file"`
+	TCP  string `mapstructure:"tcp"`
+	HTTP string `mapstructure:"http"`
+}
+
+func (s *ServiceExec) validate(name string, known bool, exists func(name string) bool) error {
+	for _, e := range s.Env {
+		i := strings.IndexByte(e, '=')
+		if i <= 0 {
+			return fmt.Errorf("service %s: env must be KEY=value, got: %s", name, e)
+		}
+	}
+
+	ready := 0
+	for _, r := range []string{s.Ready.File, s.Ready.TCP, s.Ready.HTTP} {
+		if r != "" {
+			ready++
+		}
+	}
+	if known && (len(s.Args) > 0 || len(s.Deps) > 0 || ready > 0) {
+		return fmt.Errorf("service %s: args, deps and ready are set by gocnode, use extra_args", name)
+	}
+	if ready > 1 {
+		return fmt.Errorf("service %s: only one of ready file, tcp and http can be set", name)
+	}
+	for _, dep := range s.Deps {
+		if dep == name || !exists(dep) {
+			return fmt.Errorf("service %s: unknown dependency %s", name, dep)
+		}
+	}
+	return nil
+}
+
+// validateServices validates the settings of services, known are the
+// services gocnode runs there, the other services gocnode runs cannot be
+// configured.
+func validateServices(services map[string]ServiceExec, known []string) error {
+	isKnown := func(name string) bool {
+		for _, k := range known {
+			if k == name {
+				return true
+			}
+		}
+		return false
+	}
+	exists := func(name string) bool {
+		_, ok := services[name]
+		return ok || isKnown(name)
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	// report errors in a stable order
+	sort.Strings(names)
+	for _, name := range names {
+		for _, other := range allServices {
+			if other == name && !isKnown(name) {
+				return fmt.Errorf("unknown service %s, must be one of %s or a new service", name, strings.Join(known, ", "))
+			}
+		}
+		s := services[name]
+		if err := s.validate(name, isKnown(name), exists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRTSOptions checks the GHC runtime options of cardano-node, they
+// are passed between +RTS and -RTS.
+func validateRTSOptions(opts []string) error {
+	for _, o := range opts {
+		switch {
+		case o == "+RTS" || o == "-RTS":
+			return fmt.Errorf("rts_options must not contain %s, gocnode adds it", o)
+		case !strings.HasPrefix(o, "-"):
+			return fmt.Errorf("rts option %s must start with -", o)
+		}
+	}
+	return nil
+}
+
+// RTSArgs returns the arguments passing the RTS options of the node to
+// cardano-node, none when it has no RTS options.
+func (n *Node) RTSArgs() []string {
+	if len(n.RTSOptions) == 0 {
+		return nil
+	}
+	args := append([]string{"+RTS"}, n.RTSOptions...)
+	return append(args, "-RTS")
+}
@@ -0,0 +1,77 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+const servicesConfig = `
+services:
+  prometheus:
+    path: /opt/prometheus/bin/prometheus
+    extra_args: ["--storage.tsdb.retention.time=30d"]
+relays:
+  - name: relay0
+    root_dir: /tmp/relay0
+    rts_options: ["-N2", "-A16m", "--nonmoving-gc"]
+    services:
+      cardano-node:
+        path: /opt/cardano/bin/cardano-node
+        env: ["GHCRTS=-T"]
+      db-sync:
+        path: /opt/cardano/bin/cardano-db-sync
+        args: ["--config", "/etc/db-sync.yaml"]
+        dir: /var/lib/db-sync
+        deps: [cardano-node]
+        ready:
+          tcp: 127.0.0.1:8080
+`
+
+func TestServices(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "gocnode.yaml")
+
+	cases := []struct {
+		conf string
+		err  string
+	}{
+		{servicesConfig, ""},
+		{"services:\n  cardano-node:\n    path: /bin/true\n", "unknown service cardano-node"},
+		{"relays:\n  - name: relay0\n    services:\n      prometheus:\n        path: /bin/true\n", "unknown service prometheus"},
+		{"relays:\n  - name: relay0\n    services:\n      node_exporter:\n        env: [\"=1\"]\n", "env must be KEY=value"},
+		{"relays:\n  - name: relay0\n    services:\n      node_exporter:\n        args: [\"-v\"]\n", "args, deps and ready are set by gocnode"},
+		{"relays:\n  - name: relay0\n    services:\n      db-sync:\n        deps: [postgres]\n", "unknown dependency postgres"},
+		{"relays:\n  - name: relay0\n    services:\n      db-sync:\n        ready: {file: /tmp/a, tcp: \":1\"}\n", "only one of ready"},
+		{"relays:\n  - name: relay0\n    rts_options: [\"+RTS\", \"-N\"]\n", "must not contain +RTS"},
+		{"relays:\n  - name: relay0\n    rts_options: [\"N2\"]\n", "must start with -"},
+	}
+	for _, c := range cases {
+		if err := ioutil.WriteFile(path, []byte(c.conf), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		conf, err := config.New(path, true, "debug")
+		if c.err != "" {
+			if a.NotNil(err, c.conf) {
+				a.Contains(err.Error(), c.err)
+			}
+			continue
+		}
+		if !a.Nil(err) {
+			t.FailNow()
+		}
+		a.Equal("/opt/prometheus/bin/prometheus", conf.Services[config.ServicePrometheus].Path)
+		n := conf.Relays[0]
+		a.Equal([]string{"GHCRTS=-T"}, n.Services[config.ServiceCardanoNode].Env)
+		dbSync := n.Services["db-sync"]
+		a.Equal([]string{"--config", "/etc/db-sync.yaml"}, dbSync.Args)
+		a.Equal([]string{config.ServiceCardanoNode}, dbSync.Deps)
+		a.Equal("127.0.0.1:8080", dbSync.Ready.TCP)
+		a.Equal([]string{"+RTS", "-N2", "-A16m", "--nonmoving-gc", "-RTS"}, n.RTSArgs())
+	}
+	a.Nil((&config.Node{}).RTSArgs())
+}
@@ -1,36 +1,65 @@
 package fastping
 
 import (
-	"fmt"
+	"context"
+	"net"
 	"time"
 
 	"github.com/go-ping/ping"
-	"github.com/k0kubun/pp"
 )
 
-func TestAddress(addr string) (avg time.Duration, packetLoss float64, err error) {
-	pinger, err := ping.NewPinger(addr)
-	if err != nil {
-		return 0, 0, err
+// Network returns the go-ping network to use for addr: ip4 or ip6 for IP
+// literals, ip (whatever the resolver returns first) for hostnames.
+func Network(addr string) string {
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return "ip"
+	case ip.To4() != nil:
+		return "ip4"
+	default:
+		return "ip6"
 	}
-	pinger.Size = 128
-	pinger.SetNetwork("ip")
-	pinger.SetPrivileged(false)
-	pinger.Count = 5
-	pinger.Timeout = time.Second * 2
-	err = pinger.Run() // Blocks until finished.
-	if err != nil {
-		return 1000000, 0, err
-	}
-	stats := pinger.Statistics() // get send/receive/duplicate/rtt stats
+}
+
+// TestAddress pings addr with the default options.
+func TestAddress(addr string) (Result, error) {
+	return Measure(context.Background(), addr, Options{Method: MethodICMP})
+}
+
+// pingICMP pings addr with ICMP echo requests, or ICMPv6 ones when network
+// is ip6, stopping the pinger when ctx is done.
+func pingICMP(ctx context.Context, addr string, o Options) (Result, error) {
+	res := Result{Method: MethodICMP}
 
-	if stats.PacketLoss > 0 {
-		return 1000000, stats.PacketLoss, fmt.Errorf("packets lost: %f", stats.PacketLoss)
+	pinger := ping.New(addr)
+	pinger.SetNetwork(o.Network)
+	if err := pinger.Resolve(); err != nil {
+		return res, err
 	}
+	pinger.Size = o.Size
+	pinger.SetPrivileged(false)
+	pinger.Count = o.Count
+	pinger.Interval = o.Interval
+	pinger.Timeout = o.Interval*time.Duration(o.Count) + o.Timeout
+	pinger.RecordRtts = true
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			pinger.Stop()
+		case <-finished:
+		}
+	}()
 
-	if stats.AvgRtt == time.Millisecond {
-		pp.Println(stats)
+	if err := pinger.Run(); err != nil { // Blocks until finished.
+		return res, err
 	}
+	stats := pinger.Statistics()
 
-	return stats.AvgRtt, stats.PacketLoss, err
+	// the pinger may stop before sending every packet, those count as lost
+	res = newResult(MethodICMP, o.Count, stats.Rtts, stats.PacketsRecvDuplicates)
+	return res, res.err()
 }
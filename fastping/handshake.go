@@ -0,0 +1,119 @@
+package fastping
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// MethodHandshake times a cardano node-to-node handshake, it checks that
+// the peer is a cardano node on the expected network as well as reachable.
+const MethodHandshake Method = "handshake"
+
+// node-to-node protocol versions proposed in the handshake
+var handshakeVersions = []uint64{7, 8, 9, 10}
+
+const (
+	handshakeProposeVersions = 0
+	handshakeAcceptVersion   = 1
+	handshakeRefuse          = 2
+)
+
+// HandshakeError is returned when the peer answered the handshake but
+// refused every proposed version, usually because it runs on a different
+// network.
+type HandshakeError struct {
+	Addr string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("%s refused the node-to-node handshake", e.Addr)
+}
+
+func probeHandshake(ctx context.Context, addr string, o Options) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, transport("tcp", o.Network), net.JoinHostPort(addr, strconv.Itoa(int(o.Port))))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if _, err = conn.Write(muxSegment(proposeVersions(o.Magic))); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[6:8]))
+	if _, err = io.ReadFull(conn, payload); err != nil {
+		return err
+	}
+
+	// [1, version, params] or [2, reason]
+	if len(payload) < 2 || payload[0]&0xe0 != 0x80 {
+		return fmt.Errorf("%s: unexpected handshake reply", addr)
+	}
+	switch payload[1] {
+	case handshakeAcceptVersion:
+		return nil
+	case handshakeRefuse:
+		return &HandshakeError{Addr: addr}
+	}
+	return fmt.Errorf("%s: unexpected handshake message: %d", addr, payload[1])
+}
+
+// muxSegment wraps a handshake message in an ouroboros multiplexer
+// segment: transmission time, initiator mode and mini protocol 0, length.
+func muxSegment(payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(time.Now().UnixNano()/1000))
+	binary.BigEndian.PutUint16(b[4:6], 0)
+	binary.BigEndian.PutUint16(b[6:8], uint16(len(payload)))
+	return append(b, payload...)
+}
+
+// proposeVersions encodes [0, {version: [magic, initiatorOnly]}] in CBOR.
+func proposeVersions(magic uint64) []byte {
+	b := []byte{0x82}
+	b = cborUint(b, 0, handshakeProposeVersions)
+	b = cborUint(b, 5, uint64(len(handshakeVersions)))
+	for _, v := range handshakeVersions {
+		b = cborUint(b, 0, v)
+		b = append(b, 0x82)
+		b = cborUint(b, 0, magic)
+		b = append(b, 0xf5) // true, we only initiate
+	}
+	return b
+}
+
+// cborUint appends a CBOR head with the given major type and argument.
+func cborUint(b []byte, major byte, v uint64) []byte {
+	m := major << 5
+	switch {
+	case v < 24:
+		return append(b, m|byte(v))
+	case v <= 0xff:
+		return append(b, m|24, byte(v))
+	case v <= 0xffff:
+		return append(b, m|25, byte(v>>8), byte(v))
+	case v <= 0xffffffff:
+		b = append(b, m|26)
+		return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	b = append(b, m|27)
+	for i := 7; i >= 0; i-- {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
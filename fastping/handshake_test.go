@@ -0,0 +1,93 @@
+package fastping_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/fastping"
+)
+
+// fakeNode answers every handshake with reply, after checking that the
+// proposal carries the mainnet magic
+func fakeNode(t *testing.T, reply []byte) (port uint, proposals chan []byte) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	proposals = make(chan []byte, 16)
+	go func() {
+		for {
+			conn, e := l.Accept()
+			if e != nil {
+				return
+			}
+			header := make([]byte, 8)
+			if _, e = io.ReadFull(conn, header); e != nil {
+				conn.Close()
+				continue
+			}
+			payload := make([]byte, binary.BigEndian.Uint16(header[6:8]))
+			if _, e = io.ReadFull(conn, payload); e != nil {
+				conn.Close()
+				continue
+			}
+			proposals <- payload
+
+			out := make([]byte, 8, 8+len(reply))
+			binary.BigEndian.PutUint16(out[4:6], 0x8000)
+			binary.BigEndian.PutUint16(out[6:8], uint16(len(reply)))
+			_, _ = conn.Write(append(out, reply...))
+			conn.Close()
+		}
+	}()
+	return uint(l.Addr().(*net.TCPAddr).Port), proposals
+}
+
+func TestMeasureHandshake(t *testing.T) {
+	a := assert.New(t)
+
+	// [1, 10, [764824073, false]]
+	port, proposals := fakeNode(t, []byte{0x83, 0x01, 0x0a, 0x82, 0x1a, 0x2d, 0x96, 0x4a, 0x09, 0xf4})
+	res, err := fastping.Measure(context.Background(), "127.0.0.1", fastping.Options{
+		Method:   fastping.MethodHandshake,
+		Port:     port,
+		Magic:    764824073,
+		Count:    2,
+		Interval: time.Millisecond,
+	})
+	a.Nil(err)
+	a.Equal(fastping.MethodHandshake, res.Method)
+	a.Equal(2, res.Received)
+	a.True(res.AvgRtt > 0)
+
+	proposal := <-proposals
+	// [0, {7: [764824073, true], ...
+	a.Equal([]byte{0x82, 0x00, 0xa4, 0x07, 0x82, 0x1a, 0x2d, 0x96, 0x4a, 0x09, 0xf5}, proposal[:11])
+}
+
+func TestMeasureHandshakeRefused(t *testing.T) {
+	a := assert.New(t)
+
+	// [2, [0, 10, [7, 8, 9, 10]]]
+	port, _ := fakeNode(t, []byte{0x82, 0x02, 0x83, 0x00, 0x0a, 0x84, 0x07, 0x08, 0x09, 0x0a})
+	res, err := fastping.Measure(context.Background(), "127.0.0.1", fastping.Options{
+		Method:   fastping.MethodHandshake,
+		Port:     port,
+		Magic:    1097911063,
+		Count:    1,
+		Interval: time.Millisecond,
+	})
+	a.NotNil(err)
+	a.Equal(0, res.Received)
+	var herr *fastping.HandshakeError
+	a.True(errors.As(err, &herr))
+}
@@ -0,0 +1,206 @@
+package fastping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Method is the way a round trip time was measured.
+type Method string
+
+const (
+	// MethodAuto uses ICMP when available and the fallback method otherwise
+	MethodAuto Method = "auto"
+	MethodICMP Method = "icmp"
+	// MethodTCP times TCP connects to the peer's port
+	MethodTCP Method = "tcp"
+	// MethodUDP times the answer, or the port unreachable error, to a UDP
+	// datagram sent to the peer's port
+	MethodUDP Method = "udp"
+)
+
+// Options configures Measure.
+type Options struct {
+	// Method forces a measurement method, empty means MethodAuto
+	Method Method
+	// Fallback is used when ICMP is not available, MethodTCP by default
+	Fallback Method
+	// Network is one of ip, ip4 or ip6, see Network
+	Network string
+	// Port is the peer's port, used by the TCP, UDP and handshake methods
+	Port uint
+	// Magic is the network magic sent in handshakes
+	Magic uint64
+	// Count is the number of samples, 5 by default
+	Count int
+	// Size is the ICMP or UDP payload size, 128 by default
+	Size int
+	// Interval is the wait between samples, 200ms by default
+	Interval time.Duration
+	// Timeout is how long to wait for each sample, 2s by default
+	Timeout time.Duration
+}
+
+var (
+	icmpOnce      sync.Once
+	icmpAvailable bool
+)
+
+// ICMPAvailable reports whether this process can send ICMP echo requests.
+// The check pings the loopback address once, the result is cached for the
+// lifetime of the process.
+func ICMPAvailable() bool {
+	icmpOnce.Do(func() {
+		pinger := ping.New("127.0.0.1")
+		pinger.SetPrivileged(false)
+		pinger.Count = 1
+		pinger.Timeout = time.Second
+		if err := pinger.Run(); err != nil {
+			return
+		}
+		icmpAvailable = pinger.Statistics().PacketsRecv > 0
+	})
+	return icmpAvailable
+}
+
+// method returns the method Measure uses for o.
+func (o Options) method() Method {
+	switch o.Method {
+	case MethodICMP, MethodTCP, MethodUDP, MethodHandshake:
+		return o.Method
+	}
+	if ICMPAvailable() {
+		return MethodICMP
+	}
+	if o.Fallback == MethodUDP {
+		return MethodUDP
+	}
+	return MethodTCP
+}
+
+// Measure estimates the round trip time to addr. ICMP echo requests are
+// used when they are available, otherwise the samples are taken with the
+// fallback method. Lost samples are reported in the result, an error is
+// only returned when no sample could be taken or none was answered.
+func Measure(ctx context.Context, addr string, o Options) (Result, error) {
+	if o.Network == "" {
+		o.Network = Network(addr)
+	}
+	if o.Count <= 0 {
+		o.Count = 5
+	}
+	if o.Size <= 0 {
+		o.Size = 128
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Millisecond * 200
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = time.Second * 2
+	}
+
+	switch m := o.method(); m {
+	case MethodICMP:
+		return pingICMP(ctx, addr, o)
+	case MethodUDP:
+		return sample(ctx, m, o, func(ctx context.Context) error {
+			return probeUDP(ctx, addr, o)
+		})
+	case MethodHandshake:
+		return sample(ctx, m, o, func(ctx context.Context) error {
+			return probeHandshake(ctx, addr, o)
+		})
+	default:
+		return sample(ctx, m, o, func(ctx context.Context) error {
+			return probeTCP(ctx, addr, o)
+		})
+	}
+}
+
+// sample runs probe o.Count times, o.Interval apart, and returns the
+// statistics of the round trip times.
+func sample(ctx context.Context, m Method, o Options, probe func(ctx context.Context) error) (Result, error) {
+	rtts := make([]time.Duration, 0, o.Count)
+	var lastErr error
+	for i := 0; i < o.Count; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(o.Interval):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		pctx, cancel := context.WithTimeout(ctx, o.Timeout)
+		start := time.Now()
+		if err := probe(pctx); err == nil {
+			rtts = append(rtts, time.Since(start))
+		} else {
+			lastErr = err
+		}
+		cancel()
+	}
+
+	res := newResult(m, o.Count, rtts, 0)
+	if err := res.err(); err != nil {
+		if lastErr != nil {
+			return res, fmt.Errorf("%s: %w", err.Error(), lastErr)
+		}
+		return res, err
+	}
+	return res, nil
+}
+
+// transport maps a go-ping network to the tcp or udp network with the same
+// address family.
+func transport(proto, network string) string {
+	switch network {
+	case "ip4":
+		return proto + "4"
+	case "ip6":
+		return proto + "6"
+	}
+	return proto
+}
+
+func probeTCP(ctx context.Context, addr string, o Options) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, transport("tcp", o.Network), net.JoinHostPort(addr, strconv.Itoa(int(o.Port))))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeUDP sends a datagram and waits for any answer. Peers rarely listen
+// on UDP, the port unreachable error they send back counts as an answer.
+func probeUDP(ctx context.Context, addr string, o Options) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, transport("udp", o.Network), net.JoinHostPort(addr, strconv.Itoa(int(o.Port))))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	if _, err = conn.Write(make([]byte, o.Size)); err != nil {
+		return err
+	}
+	_, err = conn.Read(make([]byte, 1500))
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return nil
+	}
+	return err
+}
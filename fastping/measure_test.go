@@ -0,0 +1,101 @@
+package fastping_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/fastping"
+)
+
+func TestMain(m *testing.M) {
+	// call flag.Parse() here if TestMain uses flags
+	os.Exit(m.Run())
+}
+
+func TestMeasureTCP(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	go func() {
+		for {
+			conn, e := l.Accept()
+			if e != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := uint(l.Addr().(*net.TCPAddr).Port)
+
+	res, err := fastping.Measure(context.Background(), "127.0.0.1", fastping.Options{
+		Method: fastping.MethodTCP,
+		Port:   port,
+		Count:  3,
+	})
+	a.Nil(err)
+	a.Equal(fastping.MethodTCP, res.Method)
+	a.Equal(3, res.Sent)
+	a.Equal(3, res.Received)
+	a.Equal(float64(0), res.PacketLoss)
+	a.True(res.MinRtt > 0)
+	a.True(res.MinRtt <= res.AvgRtt)
+	a.True(res.AvgRtt <= res.MaxRtt)
+	a.True(res.P95Rtt <= res.MaxRtt)
+	a.Equal(res.MaxRtt, res.P95Rtt)
+
+	l.Close()
+	res, err = fastping.Measure(context.Background(), "127.0.0.1", fastping.Options{
+		Method: fastping.MethodTCP,
+		Port:   port,
+		Count:  2,
+	})
+	a.NotNil(err)
+	a.Equal(0, res.Received)
+	a.Equal(float64(100), res.PacketLoss)
+	a.Equal(time.Duration(0), res.AvgRtt)
+}
+
+func TestMeasureUDP(t *testing.T) {
+	a := assert.New(t)
+
+	// nobody listens on the port, the port unreachable error is the answer
+	c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	port := uint(c.LocalAddr().(*net.UDPAddr).Port)
+	c.Close()
+
+	res, err := fastping.Measure(context.Background(), "127.0.0.1", fastping.Options{
+		Method:   fastping.MethodUDP,
+		Port:     port,
+		Count:    3,
+		Size:     64,
+		Interval: time.Millisecond,
+	})
+	a.Nil(err)
+	a.Equal(fastping.MethodUDP, res.Method)
+	a.True(res.AvgRtt > 0)
+}
+
+func TestMeasureFallback(t *testing.T) {
+	a := assert.New(t)
+
+	res, _ := fastping.Measure(context.Background(), "127.0.0.1", fastping.Options{
+		Fallback: fastping.MethodUDP,
+		Count:    1,
+	})
+	if fastping.ICMPAvailable() {
+		a.Equal(fastping.MethodICMP, res.Method)
+	} else {
+		a.Equal(fastping.MethodUDP, res.Method)
+	}
+}
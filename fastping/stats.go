@@ -0,0 +1,83 @@
+package fastping
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Result holds the statistics of a measurement and the method that was
+// used to get them. The round trip times are zero when no sample was
+// answered.
+type Result struct {
+	Method     Method
+	Sent       int
+	Received   int
+	Duplicates int
+	// PacketLoss is the percentage of samples that were not answered
+	PacketLoss float64
+	MinRtt     time.Duration
+	AvgRtt     time.Duration
+	MaxRtt     time.Duration
+	StdDevRtt  time.Duration
+	// P95Rtt is the 95th percentile of the round trip times
+	P95Rtt time.Duration
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s %d/%d received, %.1f%% loss, %d duplicates, rtt min/avg/max/stddev/p95 = %v/%v/%v/%v/%v",
+		r.Method, r.Received, r.Sent, r.PacketLoss, r.Duplicates,
+		r.MinRtt, r.AvgRtt, r.MaxRtt, r.StdDevRtt, r.P95Rtt)
+}
+
+func (r Result) err() error {
+	if r.Received == 0 {
+		return fmt.Errorf("all %d packets lost", r.Sent)
+	}
+	return nil
+}
+
+// newResult computes the statistics of rtts, the round trip times of the
+// answered samples out of sent.
+func newResult(m Method, sent int, rtts []time.Duration, duplicates int) Result {
+	r := Result{
+		Method:     m,
+		Sent:       sent,
+		Received:   len(rtts),
+		Duplicates: duplicates,
+	}
+	if r.Received > r.Sent {
+		r.Sent = r.Received
+	}
+	if r.Sent > 0 {
+		r.PacketLoss = float64(r.Sent-r.Received) / float64(r.Sent) * 100
+	}
+	if len(rtts) == 0 {
+		return r
+	}
+
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, rtt := range sorted {
+		total += rtt
+	}
+	r.MinRtt = sorted[0]
+	r.MaxRtt = sorted[len(sorted)-1]
+	r.AvgRtt = total / time.Duration(len(sorted))
+
+	var variance float64
+	for _, rtt := range sorted {
+		diff := float64(rtt - r.AvgRtt)
+		variance += diff * diff
+	}
+	r.StdDevRtt = time.Duration(math.Sqrt(variance / float64(len(sorted))))
+
+	// nearest rank percentile
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	r.P95Rtt = sorted[rank]
+	return r
+}
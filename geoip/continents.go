@@ -0,0 +1,44 @@
+package geoip
+
+import "strings"
+
+const (
+	Africa       = "AF"
+	Antarctica   = "AN"
+	Asia         = "AS"
+	Europe       = "EU"
+	NorthAmerica = "NA"
+	Oceania      = "OC"
+	SouthAmerica = "SA"
+)
+
+// ISO 3166-1 alpha-2 country codes grouped by continent.
+var continentCountries = map[string]string{
+	Africa: "AO BF BI BJ BW CD CF CG CI CM CV DJ DZ EG EH ER ET GA GH GM GN GQ GW KE KM LR LS LY MA MG ML MR MU MW " +
+		"MZ NA NE NG RE RW SC SD SH SL SN SO SS ST SZ TD TG TN TZ UG YT ZA ZM ZW",
+	Antarctica: "AQ BV GS HM TF",
+	Asia: "AE AF AM AZ BD BH BN BT CC CN CX CY GE HK ID IL IN IO IQ IR JO JP KG KH KP KR KW KZ LA LB LK MM MN MO " +
+		"MV MY NP OM PH PK PS QA SA SG SY TH TJ TL TM TR TW UZ VN YE",
+	Europe: "AD AL AT AX BA BE BG BY CH CZ DE DK EE ES FI FO FR GB GG GI GR HR HU IE IM IS IT JE LI LT LU LV MC MD " +
+		"ME MK MT NL NO PL PT RO RS RU SE SI SJ SK SM UA VA XK",
+	NorthAmerica: "AG AI AW BB BL BM BQ BS BZ CA CR CU CW DM DO GD GL GP GT HN HT JM KN KY LC MF MQ MS MX NI PA PM " +
+		"PR SV SX TC TT US VC VG VI",
+	Oceania:      "AS AU CK FJ FM GU KI MH MP NC NF NR NU NZ PF PG PN PW SB TK TO TV UM VU WF WS",
+	SouthAmerica: "AR BO BR CL CO EC FK GF GY PE PY SR UY VE",
+}
+
+var countryContinent = func() map[string]string {
+	m := make(map[string]string, 250)
+	for continent, countries := range continentCountries {
+		for _, c := range strings.Fields(countries) {
+			m[c] = continent
+		}
+	}
+	return m
+}()
+
+// ContinentOf returns the continent code for an ISO country code, or an
+// empty string if the country is unknown.
+func ContinentOf(country string) string {
+	return countryContinent[strings.ToUpper(country)]
+}
@@ -0,0 +1,172 @@
+package geoip
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Info is the location and network information known for an address.
+type Info struct {
+	ASN       uint
+	Org       string
+	Country   string
+	Continent string
+}
+
+type ipRange struct {
+	start net.IP
+	end   net.IP
+	info  Info
+}
+
+// DB is an in memory, offline GeoIP/ASN database. It is loaded from a
+// tab separated file in the ip2asn format (https://iptoasn.com):
+//
+//	range_start  range_end  AS_number  country_code  AS_description
+//
+// Both IPv4 and IPv6 ranges are supported, lines starting with # are ignored.
+type DB struct {
+	// the ranges of each family, sorted by start
+	v4 []ipRange
+	v6 []ipRange
+}
+
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "opening geoip db: %s", path)
+	}
+	defer f.Close()
+
+	db := &DB{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, er := parseLine(line)
+		if er != nil {
+			return nil, errors.Annotatef(er, "%s:%d", path, lineNum)
+		}
+		if r.info.ASN == 0 {
+			// ASN 0 marks unrouted space in ip2asn files
+			continue
+		}
+		if len(r.start) == net.IPv4len {
+			db.v4 = append(db.v4, r)
+		} else {
+			db.v6 = append(db.v6, r)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Annotatef(err, "reading geoip db: %s", path)
+	}
+
+	for _, ranges := range [][]ipRange{db.v4, db.v6} {
+		sort.Slice(ranges, func(i, j int) bool {
+			return bytes.Compare(ranges[i].start, ranges[j].start) < 0
+		})
+	}
+
+	return db, nil
+}
+
+func parseLine(line string) (r ipRange, err error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 {
+		return r, errors.Errorf("expected at least 4 tab separated fields, got %d", len(fields))
+	}
+
+	if r.start = normalize(net.ParseIP(fields[0])); r.start == nil {
+		return r, errors.Errorf("bad range start: %s", fields[0])
+	}
+	if r.end = normalize(net.ParseIP(fields[1])); r.end == nil {
+		return r, errors.Errorf("bad range end: %s", fields[1])
+	}
+	if len(r.start) != len(r.end) {
+		return r, errors.Errorf("range mixes address families: %s - %s", fields[0], fields[1])
+	}
+
+	asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[2]), "AS"), 10, 32)
+	if err != nil {
+		return r, errors.Annotatef(err, "bad AS number: %s", fields[2])
+	}
+	r.info.ASN = uint(asn)
+	r.info.Country = strings.ToUpper(strings.TrimSpace(fields[3]))
+	r.info.Continent = ContinentOf(r.info.Country)
+	if len(fields) > 4 {
+		r.info.Org = strings.TrimSpace(fields[4])
+	}
+	return r, nil
+}
+
+// normalize returns the 4 byte form of IPv4 addresses so that ranges of
+// the same family compare byte by byte.
+func normalize(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// Len returns the number of ranges loaded.
+func (db *DB) Len() int {
+	return len(db.v4) + len(db.v6)
+}
+
+// Lookup returns the information for the range containing ip.
+func (db *DB) Lookup(ip net.IP) (Info, bool) {
+	ip = normalize(ip)
+	if ip == nil || db == nil {
+		return Info{}, false
+	}
+
+	ranges := db.v6
+	if len(ip) == net.IPv4len {
+		ranges = db.v4
+	}
+
+	// first range whose start is greater than ip, the candidate is the one before
+	i := sort.Search(len(ranges), func(i int) bool {
+		return bytes.Compare(ranges[i].start, ip) > 0
+	})
+	if i == 0 {
+		return Info{}, false
+	}
+	r := ranges[i-1]
+	if bytes.Compare(ip, r.end) > 0 {
+		return Info{}, false
+	}
+	return r.info, true
+}
+
+// LookupHost resolves host, if needed, and returns the information for
+// its first address found in the database.
+func (db *DB) LookupHost(host string) (Info, bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		return db.Lookup(ip)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return Info{}, false
+	}
+	for _, ip := range ips {
+		if info, ok := db.Lookup(ip); ok {
+			return info, true
+		}
+	}
+	return Info{}, false
+}
@@ -0,0 +1,89 @@
+package geoip_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/geoip"
+)
+
+const testDB = `# range_start	range_end	AS_number	country_code	AS_description
+1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET
+1.0.1.0	1.0.3.255	0	None	Not routed
+5.9.0.0	5.9.255.255	24940	DE	HETZNER-AS
+2a01:4f8::	2a01:4f8:ffff:ffff:ffff:ffff:ffff:ffff	24940	DE	HETZNER-AS
+`
+
+func TestMain(m *testing.M) {
+	// call flag.Parse() here if TestMain uses flags
+	os.Exit(m.Run())
+}
+
+func TestLookup(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if !a.Nil(ioutil.WriteFile(path, []byte(testDB), 0o600)) {
+		t.FailNow()
+	}
+
+	db, err := geoip.Open(path)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(3, db.Len())
+
+	info, ok := db.Lookup(net.ParseIP("1.0.0.1"))
+	a.True(ok)
+	a.Equal(uint(13335), info.ASN)
+	a.Equal(geoip.NorthAmerica, info.Continent)
+
+	info, ok = db.Lookup(net.ParseIP("5.9.10.20"))
+	a.True(ok)
+	a.Equal("DE", info.Country)
+	a.Equal(geoip.Europe, info.Continent)
+
+	info, ok = db.Lookup(net.ParseIP("2a01:4f8:10::1"))
+	a.True(ok)
+	a.Equal(uint(24940), info.ASN)
+
+	_, ok = db.Lookup(net.ParseIP("1.0.2.1"))
+	a.False(ok)
+
+	_, ok = db.Lookup(net.ParseIP("8.8.8.8"))
+	a.False(ok)
+}
+
+const mixedDB = `2a00::	2a0f:ffff:ffff:ffff:ffff:ffff:ffff:ffff	3320	DE	DTAG
+42.1.1.0	42.1.1.255	4766	KR	KIXS-AS-KR
+`
+
+func TestLookupMixedFamilies(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if !a.Nil(ioutil.WriteFile(path, []byte(mixedDB), 0o600)) {
+		t.FailNow()
+	}
+	db, err := geoip.Open(path)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	// 42.1.1.0 sorts between the start of the IPv6 range and the address
+	info, ok := db.Lookup(net.ParseIP("2a01:4f8:10::1"))
+	a.True(ok)
+	a.Equal(uint(3320), info.ASN)
+
+	info, ok = db.Lookup(net.ParseIP("42.1.1.7"))
+	a.True(ok)
+	a.Equal(uint(4766), info.ASN)
+
+	_, ok = db.Lookup(net.ParseIP("42.1.2.1"))
+	a.False(ok)
+}
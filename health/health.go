@@ -0,0 +1,236 @@
+// Package health serves the /healthz and /readyz endpoints of a node.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/nodemetrics"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+// Status of a check or a report
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusStarting = "starting"
+)
+
+// cardanoNode is the service name of cardano-node in the supervisor
+const cardanoNode = config.ServiceCardanoNode
+
+// liveServices are the services whose failure fails /healthz, the other
+// services, such as the topology updater, do not make the node unhealthy
+var liveServices = map[string]bool{
+	config.ServiceCardanoNode:  true,
+	config.ServiceNodeExporter: true,
+}
+
+// listenRetry is how long Serve waits before listening again after failing
+const listenRetry = time.Second * 30
+
+// Check is the result of a single check.
+type Check struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the JSON body of /healthz and /readyz.
+type Report struct {
+	Status   string                  `json:"status"`
+	Node     string                  `json:"node"`
+	Checks   map[string]Check        `json:"checks"`
+	Services []process.ServiceStatus `json:"services"`
+	Tip      nodemetrics.Tip         `json:"tip"`
+}
+
+// Checker checks the health of a node.
+type Checker struct {
+	conf     config.Health
+	node     string
+	socket   string
+	services func() []process.ServiceStatus
+	tracker  *nodemetrics.Tracker
+	log      *zap.SugaredLogger
+}
+
+// New returns the checker of node n, whose services are reported by
+// services, whose socket is at socket and whose tip is tracked by tracker.
+func New(log *zap.SugaredLogger, n *config.Node, socket string, services func() []process.ServiceStatus,
+	tracker *nodemetrics.Tracker) *Checker {
+	return &Checker{
+		conf:     n.Health,
+		node:     n.Name,
+		socket:   socket,
+		services: services,
+		tracker:  tracker,
+		log:      log,
+	}
+}
+
+// Health runs the liveness checks.
+func (c *Checker) Health() Report {
+	return c.report(false)
+}
+
+// Ready runs the liveness checks and the tip check.
+func (c *Checker) Ready() Report {
+	return c.report(true)
+}
+
+func (c *Checker) report(ready bool) Report {
+	r := Report{
+		Status:   StatusOK,
+		Node:     c.node,
+		Checks:   make(map[string]Check),
+		Services: c.services(),
+	}
+	tip, scrapeErr := c.tracker.Tip()
+	r.Tip = tip
+
+	var started time.Time
+	r.Checks["processes"] = c.checkProcesses(r.Services, &started)
+	// cardano-node takes a while to open its socket and metrics endpoint
+	// after it starts, possibly revalidating its database
+	starting := !started.IsZero() && time.Since(started) < c.conf.StartupGrace
+
+	socket := Check{Status: StatusOK}
+	if _, err := os.Stat(c.socket); err != nil {
+		socket = Check{Status: StatusFail, Detail: err.Error()}
+	}
+	r.Checks["socket"] = c.grace(socket, starting)
+
+	metrics := Check{Status: StatusOK}
+	last := c.tracker.LastScrape()
+	switch {
+	case last.IsZero():
+		metrics = Check{Status: StatusFail, Detail: "metrics not scraped yet"}
+	case scrapeErr != nil:
+		metrics = Check{Status: StatusFail, Detail: scrapeErr.Error()}
+	case time.Since(last) > 3*c.conf.ScrapeInterval:
+		metrics = Check{Status: StatusFail, Detail: fmt.Sprintf("metrics last scraped at %s", last.Format(time.RFC3339))}
+	}
+	r.Checks["metrics"] = c.grace(metrics, starting)
+
+	if ready {
+		t := Check{Status: StatusOK, Detail: fmt.Sprintf("block %d, slot %d", tip.Block, tip.Slot)}
+		if tip.AdvancedAt.IsZero() {
+			t = Check{Status: StatusFail, Detail: "no tip yet"}
+		} else if age := time.Since(tip.AdvancedAt); age > c.conf.MaxTipAge {
+			t = Check{Status: StatusFail, Detail: fmt.Sprintf("tip at block %d did not advance for %v", tip.Block, age.Round(time.Second))}
+		}
+		r.Checks["tip"] = t
+	}
+
+	for name, ch := range r.Checks {
+		// starting checks are fine to be alive but not to be ready
+		if ch.Status == StatusFail || (ready && ch.Status == StatusStarting) {
+			r.Status = StatusFail
+			c.log.Debugf("health check %s failed: %s", name, ch.Detail)
+		}
+	}
+	return r
+}
+
+func (c *Checker) grace(ch Check, starting bool) Check {
+	if ch.Status == StatusFail && starting {
+		ch.Status = StatusStarting
+	}
+	return ch
+}
+
+// checkProcesses fails when cardano-node is not running or it or
+// node_exporter gave up, started is set to the time cardano-node started.
+func (c *Checker) checkProcesses(services []process.ServiceStatus, started *time.Time) Check {
+	found := false
+	for _, s := range services {
+		if !liveServices[s.Name] {
+			continue
+		}
+		switch s.State {
+		case process.StateCrashLoop, process.StateFailed:
+			return Check{Status: StatusFail, Detail: fmt.Sprintf("%s is %s: %s", s.Name, s.State, s.LastError)}
+		}
+		if s.Name != cardanoNode {
+			continue
+		}
+		found = true
+		if s.State != process.StateRunning {
+			return Check{Status: StatusFail, Detail: fmt.Sprintf("%s is %s", s.Name, s.State)}
+		}
+		*started = s.StartedAt
+	}
+	if !found {
+		return Check{Status: StatusFail, Detail: "cardano-node is not supervised"}
+	}
+	return Check{Status: StatusOK}
+}
+
+// Handler serves /healthz and /readyz, they answer 200 when the node is
+// healthy, or ready, and 503 otherwise, with the report as body.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		c.write(w, c.Health())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		c.write(w, c.Ready())
+	})
+	return mux
+}
+
+func (c *Checker) write(w http.ResponseWriter, r Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		c.log.Errorf("writing health report: %s", err.Error())
+	}
+}
+
+// Serve serves the endpoints on the health port until ctx is done. Failing
+// to serve them is logged and retried, it never stops the node.
+func (c *Checker) Serve(ctx context.Context) error {
+	for {
+		if err := c.serve(ctx); err != nil {
+			c.log.Errorf("health endpoints not served, retrying in %v: %s", listenRetry, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(listenRetry):
+		}
+	}
+}
+
+func (c *Checker) serve(ctx context.Context) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", c.conf.Port))
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: c.Handler()}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(l)
+	}()
+	c.log.Infof("serving /healthz and /readyz on %s", l.Addr())
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
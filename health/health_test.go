@@ -0,0 +1,158 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/health"
+	"github.com/adakailabs/gocnode/nodemetrics"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+type fixture struct {
+	checker  *health.Checker
+	tracker  *nodemetrics.Tracker
+	socket   string
+	services []process.ServiceStatus
+	block    int
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{
+		block:  5798765,
+		socket: filepath.Join(t.TempDir(), "node.socket"),
+		services: []process.ServiceStatus{
+			{Name: "cardano-node", State: process.StateRunning, StartedAt: time.Now().Add(-time.Hour)},
+			{Name: "node_exporter", State: process.StateRunning},
+			{Name: "topology_updater", State: process.StateRunning},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "cardano_node_metrics_blockNum_int %d\ncardano_node_metrics_slotNum_int %d\n", f.block, f.block*5)
+	}))
+	t.Cleanup(srv.Close)
+
+	n := &config.Node{Name: "relay0", Health: config.Health{
+		ScrapeInterval: time.Minute,
+		StartupGrace:   time.Minute * 10,
+		MaxTipAge:      time.Millisecond * 50,
+	}}
+	f.tracker = nodemetrics.NewTracker(srv.URL, time.Second)
+	f.checker = health.New(zap.NewNop().Sugar(), n, f.socket, func() []process.ServiceStatus { return f.services }, f.tracker)
+	return f
+}
+
+func get(a *assert.Assertions, h http.Handler, path string) (int, health.Report) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	r := health.Report{}
+	a.Nil(json.Unmarshal(w.Body.Bytes(), &r))
+	return w.Code, r
+}
+
+func TestHealth(t *testing.T) {
+	a := assert.New(t)
+	f := newFixture(t)
+	h := f.checker.Handler()
+
+	// no socket and no metrics yet
+	code, r := get(a, h, "/healthz")
+	a.Equal(http.StatusServiceUnavailable, code)
+	a.Equal(health.StatusFail, r.Status)
+	a.Equal(health.StatusOK, r.Checks["processes"].Status)
+	a.Equal(health.StatusFail, r.Checks["socket"].Status)
+	a.Equal(health.StatusFail, r.Checks["metrics"].Status)
+	a.Len(r.Services, 3)
+
+	a.Nil(ioutil.WriteFile(f.socket, nil, 0o600))
+	_, err := f.tracker.Scrape(context.Background())
+	a.Nil(err)
+	code, r = get(a, h, "/healthz")
+	a.Equal(http.StatusOK, code)
+	a.Equal(health.StatusOK, r.Status)
+	a.Equal(uint64(5798765), r.Tip.Block)
+
+	code, r = get(a, h, "/readyz")
+	a.Equal(http.StatusOK, code)
+	a.Equal(health.StatusOK, r.Checks["tip"].Status)
+
+	// the tip stalls: alive but not ready
+	time.Sleep(time.Millisecond * 60)
+	_, err = f.tracker.Scrape(context.Background())
+	a.Nil(err)
+	code, _ = get(a, h, "/healthz")
+	a.Equal(http.StatusOK, code)
+	code, r = get(a, h, "/readyz")
+	a.Equal(http.StatusServiceUnavailable, code)
+	a.Equal(health.StatusFail, r.Checks["tip"].Status)
+
+	f.block++
+	_, err = f.tracker.Scrape(context.Background())
+	a.Nil(err)
+	code, _ = get(a, h, "/readyz")
+	a.Equal(http.StatusOK, code)
+
+	// the node is alive whatever the other services
+	f.services[2].State = process.StateFailed
+	code, _ = get(a, h, "/healthz")
+	a.Equal(http.StatusOK, code)
+
+	f.services[1].State = process.StateCrashLoop
+	code, r = get(a, h, "/healthz")
+	a.Equal(http.StatusServiceUnavailable, code)
+	a.Contains(r.Checks["processes"].Detail, "node_exporter")
+}
+
+func TestHealthStartupGrace(t *testing.T) {
+	a := assert.New(t)
+	f := newFixture(t)
+	f.services[0].StartedAt = time.Now()
+	h := f.checker.Handler()
+
+	// a starting node is alive without socket and metrics but not ready
+	code, r := get(a, h, "/healthz")
+	a.Equal(http.StatusOK, code)
+	a.Equal(health.StatusStarting, r.Checks["socket"].Status)
+	a.Equal(health.StatusStarting, r.Checks["metrics"].Status)
+	code, _ = get(a, h, "/readyz")
+	a.Equal(http.StatusServiceUnavailable, code)
+
+	f.services[0].State = process.StateBackoff
+	code, _ = get(a, h, "/healthz")
+	a.Equal(http.StatusServiceUnavailable, code)
+}
+
+func TestServePortTaken(t *testing.T) {
+	a := assert.New(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	defer l.Close()
+
+	n := &config.Node{Name: "relay0", Health: config.Health{Port: uint(l.Addr().(*net.TCPAddr).Port)}}
+	c := health.New(zap.NewNop().Sugar(), n, "", func() []process.ServiceStatus { return nil },
+		nodemetrics.NewTracker("http://127.0.0.1:1/metrics", time.Second))
+
+	// the port is taken, Serve keeps retrying instead of failing
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	a.Nil(c.Serve(ctx))
+}
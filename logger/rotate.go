@@ -0,0 +1,267 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotateConfig configures a Rotator.
+type RotateConfig struct {
+	// Path is the file written to, the backups are written next to it
+	Path string
+	// MaxSize is the size in bytes after which the file is rotated, 0
+	// disables size rotation
+	MaxSize int64
+	// MaxAge is the age after which the file is rotated, 0 disables age
+	// rotation
+	MaxAge time.Duration
+	// MaxBackups is how many backups are kept, 0 keeps them all
+	MaxBackups int
+	// Retention is how long backups are kept, 0 keeps them forever
+	Retention time.Duration
+	// Compress gzips the backups
+	Compress bool
+}
+
+// Rotator is an io.WriteCloser writing to a file that is rotated by size
+// and age. Rotated files are renamed with a timestamp,
+// name-20060102T150405.000.log, followed by a counter, -1, -2..., when a
+// backup with that name exists, and optionally compressed. The backups over
+// MaxBackups or older than Retention are removed. The age of a file that
+// exists when it is opened is counted from its modification time. Rotator
+// is safe for concurrent use.
+type Rotator struct {
+	c RotateConfig
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// background serializes the compression and removal of backups
+	background sync.Mutex
+	wg         sync.WaitGroup
+}
+
+func NewRotator(c RotateConfig) (*Rotator, error) {
+	r := &Rotator{c: c}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rotator) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.c.Path), os.ModePerm); err != nil {
+		return errors.Annotatef(err, "creating log dir for %s", r.c.Path)
+	}
+	f, err := os.OpenFile(r.c.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f = f
+	r.size = fi.Size()
+	r.opened = time.Now()
+	if r.size > 0 {
+		r.opened = fi.ModTime()
+	}
+	return nil
+}
+
+// Write writes p to the file, rotating it first when p does not fit in
+// MaxSize or the file is older than MaxAge.
+func (r *Rotator) Write(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		if err = r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && ((r.c.MaxSize > 0 && r.size+int64(len(p)) > r.c.MaxSize) ||
+		(r.c.MaxAge > 0 && time.Since(r.opened) >= r.c.MaxAge)) {
+		if err = r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now.
+func (r *Rotator) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+func (r *Rotator) rotate() error {
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			return err
+		}
+		r.f = nil
+	}
+
+	backup := r.backupName(time.Now())
+	if err := os.Rename(r.c.Path, backup); err != nil && !os.IsNotExist(err) {
+		return errors.Annotatef(err, "rotating %s", r.c.Path)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.background.Lock()
+		defer r.background.Unlock()
+		if r.c.Compress {
+			if err := compress(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "compressing %s: %s\n", backup, err.Error())
+			}
+		}
+		r.prune()
+	}()
+	return nil
+}
+
+// backupName returns a name for a backup rotated at t that is not used by
+// another backup, compressed or not.
+func (r *Rotator) backupName(t time.Time) string {
+	ext := filepath.Ext(r.c.Path)
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(r.c.Path, ext), t.Format(backupTimeFormat))
+	name := base + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// compress gzips path to path.gz and removes path.
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Backups returns the backups of the file, oldest first.
+func (r *Rotator) Backups() ([]string, error) {
+	ext := filepath.Ext(r.c.Path)
+	prefix := strings.TrimSuffix(r.c.Path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		path  string
+		stamp string
+		n     int
+	}
+	backups := make([]backup, 0, len(matches))
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimSuffix(m, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		n := 0
+		if i := strings.LastIndex(stamp, "-"); i >= 0 {
+			if n, err = strconv.Atoi(stamp[i+1:]); err != nil || n < 1 {
+				continue
+			}
+			stamp = stamp[:i]
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, backup{path: m, stamp: stamp, n: n})
+		}
+	}
+	// the timestamps sort lexically, then the counters
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].stamp != backups[j].stamp {
+			return backups[i].stamp < backups[j].stamp
+		}
+		return backups[i].n < backups[j].n
+	})
+	paths := make([]string, len(backups))
+	for i := range backups {
+		paths[i] = backups[i].path
+	}
+	return paths, nil
+}
+
+// prune removes the backups over MaxBackups and older than Retention.
+func (r *Rotator) prune() {
+	backups, err := r.Backups()
+	if err != nil {
+		return
+	}
+	for i, b := range backups {
+		remove := r.c.MaxBackups > 0 && i < len(backups)-r.c.MaxBackups
+		if !remove && r.c.Retention > 0 {
+			if fi, er := os.Stat(b); er == nil && time.Since(fi.ModTime()) > r.c.Retention {
+				remove = true
+			}
+		}
+		if remove {
+			_ = os.Remove(b)
+		}
+	}
+}
+
+// Close closes the file and waits for the backups being compressed.
+func (r *Rotator) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
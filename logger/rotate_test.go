@@ -0,0 +1,176 @@
+package logger_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	l "github.com/adakailabs/gocnode/logger"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+func TestRotatorSize(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "logs", "cardano-node.log")
+	r, err := l.NewRotator(l.RotateConfig{Path: path, MaxSize: 20, MaxBackups: 2})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	for _, line := range []string{"line 1 0123456789\n", "line 2 0123456789\n", "line 3 0123456789\n", "line 4 0123456789\n"} {
+		_, err = r.Write([]byte(line))
+		a.Nil(err)
+		// backups are named after the time they are rotated at
+		time.Sleep(time.Millisecond * 2)
+	}
+	a.Nil(r.Close())
+
+	b, err := ioutil.ReadFile(path)
+	a.Nil(err)
+	a.Equal("line 4 0123456789\n", string(b))
+
+	backups, err := r.Backups()
+	a.Nil(err)
+	if !a.Len(backups, 2) {
+		t.FailNow()
+	}
+	b, err = ioutil.ReadFile(backups[0])
+	a.Nil(err)
+	a.Equal("line 2 0123456789\n", string(b))
+	a.True(strings.HasPrefix(filepath.Base(backups[0]), "cardano-node-"))
+	a.True(strings.HasSuffix(backups[0], ".log"))
+}
+
+func TestRotatorAgeCompress(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "node_exporter.log")
+	r, err := l.NewRotator(l.RotateConfig{Path: path, MaxAge: time.Millisecond * 20, Compress: true})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	_, err = r.Write([]byte("first\n"))
+	a.Nil(err)
+	_, err = r.Write([]byte("still first\n"))
+	a.Nil(err)
+	time.Sleep(time.Millisecond * 30)
+	_, err = r.Write([]byte("second\n"))
+	a.Nil(err)
+	a.Nil(r.Close())
+
+	backups, err := r.Backups()
+	a.Nil(err)
+	if !a.Len(backups, 1) {
+		t.FailNow()
+	}
+	a.True(strings.HasSuffix(backups[0], ".log.gz"))
+
+	f, err := os.Open(backups[0])
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	b, err := ioutil.ReadAll(gz)
+	a.Nil(err)
+	a.Equal("first\nstill first\n", string(b))
+
+	b, err = ioutil.ReadFile(path)
+	a.Nil(err)
+	a.Equal("second\n", string(b))
+}
+
+func TestRotatorRetention(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rtview.log")
+
+	old := filepath.Join(dir, "rtview-20210510T185735.210.log.gz")
+	a.Nil(ioutil.WriteFile(old, []byte("old"), 0o600))
+	a.Nil(os.Chtimes(old, time.Now().Add(-time.Hour*48), time.Now().Add(-time.Hour*48)))
+	// files that are not backups are left alone
+	other := filepath.Join(dir, "rtview-notes.log")
+	a.Nil(ioutil.WriteFile(other, []byte("notes"), 0o600))
+
+	r, err := l.NewRotator(l.RotateConfig{Path: path, Retention: time.Hour * 24})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	_, err = r.Write([]byte("current\n"))
+	a.Nil(err)
+	a.Nil(r.Rotate())
+	a.Nil(r.Close())
+
+	backups, err := r.Backups()
+	a.Nil(err)
+	a.Len(backups, 1)
+	a.NotEqual(old, backups[0])
+	_, err = os.Stat(other)
+	a.Nil(err)
+}
+
+func TestRotatorReopenAge(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "cardano-node.log")
+	a.Nil(ioutil.WriteFile(path, []byte("before restart\n"), 0o600))
+	a.Nil(os.Chtimes(path, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+
+	// the file written before a restart keeps its age
+	r, err := l.NewRotator(l.RotateConfig{Path: path, MaxAge: time.Minute * 30})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	_, err = r.Write([]byte("after restart\n"))
+	a.Nil(err)
+	a.Nil(r.Close())
+
+	backups, err := r.Backups()
+	a.Nil(err)
+	if !a.Len(backups, 1) {
+		t.FailNow()
+	}
+	b, err := ioutil.ReadFile(backups[0])
+	a.Nil(err)
+	a.Equal("before restart\n", string(b))
+}
+
+func TestRotatorSameTime(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "cardano-node.log")
+	r, err := l.NewRotator(l.RotateConfig{Path: path})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	// rotations within the same millisecond do not overwrite each other
+	lines := []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n", "line 5\n"}
+	for _, line := range lines {
+		_, err = r.Write([]byte(line))
+		a.Nil(err)
+		a.Nil(r.Rotate())
+	}
+	a.Nil(r.Close())
+
+	backups, err := r.Backups()
+	a.Nil(err)
+	if !a.Len(backups, len(lines)) {
+		t.FailNow()
+	}
+	for i, backup := range backups {
+		b, er := ioutil.ReadFile(backup)
+		a.Nil(er)
+		a.Equal(lines[i], string(b))
+	}
+}
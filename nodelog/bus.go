@@ -0,0 +1,70 @@
+package nodelog
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Handler is called with the events a subscriber receives, it runs on the
+// goroutine reading cardano-node's output and must not block.
+type Handler func(e Event)
+
+// Bus distributes the events parsed from cardano-node's output to its
+// subscribers. A nil Bus drops every event.
+type Bus struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int]Handler)}
+}
+
+// Subscribe registers h, it is called with every published event until the
+// returned function is called.
+func (b *Bus) Subscribe(h Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs[id] = h
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// SubscribeNamespace registers h for the events whose namespace is ns or
+// below it and whose severity is at least min.
+func (b *Bus) SubscribeNamespace(ns string, min Severity, h Handler) (unsubscribe func()) {
+	return b.Subscribe(func(e Event) {
+		if e.Severity >= min && (ns == "" || e.Namespace == ns || strings.HasPrefix(e.Namespace, ns+".")) {
+			h(e)
+		}
+	})
+}
+
+// Publish calls the subscribers with e, in subscription order.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	ids := make([]int, 0, len(b.subs))
+	for id := range b.subs {
+		ids = append(ids, id)
+	}
+	handlers := make([]Handler, 0, len(ids))
+	sort.Ints(ids)
+	for _, id := range ids {
+		handlers = append(handlers, b.subs[id])
+	}
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(e)
+	}
+}
@@ -0,0 +1,163 @@
+// Package nodelog parses the log output of cardano-node, in both its text and
+// JSON formats, into typed events.
+package nodelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Severity is the severity of a cardano-node log event, ordered from the
+// least to the most severe.
+type Severity int
+
+const (
+	Debug Severity = iota
+	Info
+	Notice
+	Warning
+	Error
+	Critical
+	Alert
+	Emergency
+)
+
+var severityNames = []string{"Debug", "Info", "Notice", "Warning", "Error", "Critical", "Alert", "Emergency"}
+
+func (s Severity) String() string {
+	if s < Debug || s > Emergency {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity as written by cardano-node.
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return Debug, fmt.Errorf("unknown severity: %s", s)
+}
+
+// Event is a cardano-node log entry.
+type Event struct {
+	Namespace string
+	Severity  Severity
+	// Host is the (truncated) host name cardano-node runs on
+	Host   string
+	Thread string
+	Time   time.Time
+	// Message is the text of the entry, for JSON entries the msg field
+	Message string
+	// Kind is the kind field of the data of JSON entries, such as
+	// TraceAddBlockEvent.AddedToCurrentChain
+	Kind string
+	// Data holds the structured data of JSON entries
+	Data map[string]interface{}
+	// Raw is the line the event was parsed from
+	Raw string
+}
+
+// textRe matches the text format, possibly prefixed as by docker logs:
+//
+//	[34e768bb:cardano.node.DnsSubscription:Error:17976] [2021-05-10 18:57:35.21 UTC] Domain: ...
+var textRe = regexp.MustCompile(`\[([^:\]]*):([^:\]]+):([A-Za-z]+):([^\]]*)\] \[([^\]]+)\] ?(.*)$`)
+
+const textTimeLayout = "2006-01-02 15:04:05.999999999 MST"
+
+// jsonEntry is an entry of the JSON format.
+type jsonEntry struct {
+	At     time.Time              `json:"at"`
+	NS     []string               `json:"ns"`
+	Data   map[string]interface{} `json:"data"`
+	Msg    string                 `json:"msg"`
+	Sev    string                 `json:"sev"`
+	Host   string                 `json:"host"`
+	Thread string                 `json:"thread"`
+}
+
+// Parse parses a line of cardano-node output, in the text or the JSON
+// format. Lines in neither format are an error.
+func Parse(line string) (Event, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if i := strings.IndexByte(line, '{'); i >= 0 && strings.HasSuffix(line, "}") {
+		if e, err := parseJSON(line[i:]); err == nil {
+			e.Raw = line
+			return e, nil
+		}
+	}
+
+	m := textRe.FindStringSubmatch(line)
+	if m == nil {
+		return Event{}, fmt.Errorf("not a cardano-node log line: %q", line)
+	}
+	sev, err := ParseSeverity(m[3])
+	if err != nil {
+		return Event{}, err
+	}
+	at, err := time.Parse(textTimeLayout, m[5])
+	if err != nil {
+		return Event{}, fmt.Errorf("invalid timestamp in log line: %s", m[5])
+	}
+	return Event{
+		Host:      m[1],
+		Namespace: m[2],
+		Severity:  sev,
+		Thread:    m[4],
+		Time:      at,
+		Message:   m[6],
+		Raw:       line,
+	}, nil
+}
+
+func parseJSON(s string) (Event, error) {
+	j := jsonEntry{}
+	if err := json.Unmarshal([]byte(s), &j); err != nil {
+		return Event{}, err
+	}
+	if len(j.NS) == 0 || j.Sev == "" {
+		return Event{}, fmt.Errorf("not a cardano-node log entry")
+	}
+	sev, err := ParseSeverity(j.Sev)
+	if err != nil {
+		return Event{}, err
+	}
+	e := Event{
+		Namespace: strings.Join(j.NS, "."),
+		Severity:  sev,
+		Host:      j.Host,
+		Thread:    j.Thread,
+		Time:      j.At,
+		Message:   j.Msg,
+		Data:      j.Data,
+	}
+	if kind, ok := j.Data["kind"].(string); ok {
+		e.Kind = kind
+	}
+	return e, nil
+}
+
+// exceededTimeLimitRe matches
+// Application Exception: 76.255.14.156:3005 ExceededTimeLimit
+var exceededTimeLimitRe = regexp.MustCompile(`Application Exception: (\S+:\d+) ExceededTimeLimit`)
+
+// connectionRefusedRe matches
+// Connection Attempt Exception, destination 186.32.161.134:5100 exception: Network.Socket.connect: <socket: 48>: does not exist (Connection refused)
+var connectionRefusedRe = regexp.MustCompile(`Connection Attempt Exception, destination (\S+) exception: .*Connection refused`)
+
+// PeerFailure reports whether e is cardano-node failing to reach a peer,
+// and returns the peer, as ip:port, and the failure.
+func PeerFailure(e Event) (peer, failure string, ok bool) {
+	if m := exceededTimeLimitRe.FindStringSubmatch(e.Raw); m != nil {
+		return m[1], "time limit error", true
+	}
+	if m := connectionRefusedRe.FindStringSubmatch(e.Raw); m != nil {
+		return m[1], "connection refused", true
+	}
+	return "", "", false
+}
@@ -0,0 +1,136 @@
+package nodelog_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/nodelog"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+// dnsLine is a line of cardano-node output as shown by docker service logs
+const dnsLine = `cardano_relay1.1.7ok8rxpj2x8d@raspberry00    | [34e768bb:cardano.node.DnsSubscription:Error:17976] [2021-05-10 18:57:35.21 UTC] Domain: "rocinante.mooo.com" Connection Attempt Exception, destination 186.32.161.134:5100 exception: Network.Socket.connect: <socket: 48>: does not exist (Connection refused)`
+
+const chainDBLine = `[34e768bb:cardano.node.ChainDB:Notice:47] [2021-05-10 18:57:36.02 UTC] Chain extended, new tip: 6df8fe7bb3e6f2b7f0db2b4dd3e0b4a3f36b5b8a5c43ad0e3e6a1ab5d96b5c1d at slot 28857120`
+
+const jsonLine = `{"at":"2021-05-10T18:57:36.02Z","env":"1.26.2:3531289c","ns":["cardano.node.ChainDB"],"data":{"newtip":"6df8fe7bb3e6f2b7f0db2b4dd3e0b4a3f36b5b8a5c43ad0e3e6a1ab5d96b5c1d@28857120","kind":"TraceAddBlockEvent.AddedToCurrentChain","headers":[{"hash":"6df8fe7bb3e6f2b7f0db2b4dd3e0b4a3f36b5b8a5c43ad0e3e6a1ab5d96b5c1d","kind":"ShelleyBlock","blockNo":"5798765","slotNo":"28857120"}]},"app":[],"msg":"","pid":"1","loc":null,"host":"34e768bb","sev":"Info","thread":"47"}`
+
+func TestParseText(t *testing.T) {
+	a := assert.New(t)
+
+	e, err := nodelog.Parse(dnsLine + "\n")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal("34e768bb", e.Host)
+	a.Equal("cardano.node.DnsSubscription", e.Namespace)
+	a.Equal(nodelog.Error, e.Severity)
+	a.Equal("17976", e.Thread)
+	a.True(time.Date(2021, 5, 10, 18, 57, 35, 210000000, time.UTC).Equal(e.Time))
+	a.Equal(`Domain: "rocinante.mooo.com" Connection Attempt Exception, destination 186.32.161.134:5100 exception: Network.Socket.connect: <socket: 48>: does not exist (Connection refused)`, e.Message)
+	a.Equal(dnsLine, e.Raw)
+
+	e, err = nodelog.Parse(chainDBLine)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(nodelog.Notice, e.Severity)
+	a.Equal("cardano.node.ChainDB", e.Namespace)
+	a.Contains(e.Message, "at slot 28857120")
+}
+
+func TestParseJSON(t *testing.T) {
+	a := assert.New(t)
+
+	e, err := nodelog.Parse(jsonLine)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal("34e768bb", e.Host)
+	a.Equal("cardano.node.ChainDB", e.Namespace)
+	a.Equal(nodelog.Info, e.Severity)
+	a.Equal("47", e.Thread)
+	a.True(time.Date(2021, 5, 10, 18, 57, 36, 20000000, time.UTC).Equal(e.Time))
+	a.Equal("TraceAddBlockEvent.AddedToCurrentChain", e.Kind)
+	a.Equal("6df8fe7bb3e6f2b7f0db2b4dd3e0b4a3f36b5b8a5c43ad0e3e6a1ab5d96b5c1d@28857120", e.Data["newtip"])
+}
+
+func TestParseInvalid(t *testing.T) {
+	a := assert.New(t)
+	for _, line := range []string{
+		"",
+		"Listening on http://127.0.0.1:12798",
+		`{"level":"info","msg":"not cardano-node"}`,
+		"[34e768bb:cardano.node.ChainDB:Loud:47] [2021-05-10 18:57:36.02 UTC] unknown severity",
+	} {
+		_, err := nodelog.Parse(line)
+		a.NotNil(err, line)
+	}
+}
+
+func TestBus(t *testing.T) {
+	a := assert.New(t)
+	b := nodelog.NewBus()
+
+	all := make([]string, 0)
+	unsubscribe := b.Subscribe(func(e nodelog.Event) { all = append(all, e.Namespace) })
+	errs := make([]string, 0)
+	b.SubscribeNamespace("cardano.node", nodelog.Error, func(e nodelog.Event) { errs = append(errs, e.Namespace) })
+	chainDB := 0
+	b.SubscribeNamespace("cardano.node.ChainDB", nodelog.Debug, func(e nodelog.Event) { chainDB++ })
+
+	for _, line := range []string{dnsLine, chainDBLine, jsonLine} {
+		e, err := nodelog.Parse(line)
+		if !a.Nil(err) {
+			t.FailNow()
+		}
+		b.Publish(e)
+	}
+	a.Equal([]string{"cardano.node.DnsSubscription", "cardano.node.ChainDB", "cardano.node.ChainDB"}, all)
+	a.Equal([]string{"cardano.node.DnsSubscription"}, errs)
+	a.Equal(2, chainDB)
+
+	unsubscribe()
+	b.Publish(nodelog.Event{Namespace: "cardano.node.ChainDB"})
+	a.Len(all, 3)
+	a.Equal(3, chainDB)
+
+	// a nil bus drops the events
+	var nilBus *nodelog.Bus
+	nilBus.Publish(nodelog.Event{})
+}
+
+func TestPeerFailure(t *testing.T) {
+	a := assert.New(t)
+
+	e, err := nodelog.Parse(dnsLine)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	peer, failure, ok := nodelog.PeerFailure(e)
+	a.True(ok)
+	a.Equal("186.32.161.134:5100", peer)
+	a.Equal("connection refused", failure)
+
+	e, err = nodelog.Parse(`[34e768bb:cardano.node.ErrorPolicy:Notice:96] [2021-05-10 18:57:35.21 UTC] IP 76.255.14.156:3005 ErrorPolicySuspendPeer (Just (ApplicationExceptionTrace (MuxError MuxIngressQueueOverRun "Application Exception: 76.255.14.156:3005 ExceededTimeLimit")))`)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	peer, failure, ok = nodelog.PeerFailure(e)
+	a.True(ok)
+	a.Equal("76.255.14.156:3005", peer)
+	a.Equal("time limit error", failure)
+
+	e, err = nodelog.Parse(chainDBLine)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	_, _, ok = nodelog.PeerFailure(e)
+	a.False(ok)
+}
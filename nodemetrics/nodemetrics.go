@@ -0,0 +1,161 @@
+// Package nodemetrics scrapes the prometheus metrics of cardano-node and
+// tracks its chain tip over time.
+package nodemetrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics of the chain tip exported by cardano-node
+const (
+	BlockNum = "cardano_node_metrics_blockNum_int"
+	SlotNum  = "cardano_node_metrics_slotNum_int"
+	EpochNum = "cardano_node_metrics_epoch_int"
+)
+
+// Parse reads metrics in the prometheus text format, labels are ignored.
+func Parse(r io.Reader) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := line
+		rest := ""
+		if i := strings.IndexAny(line, "{ "); i >= 0 {
+			name = line[:i]
+			rest = line[i:]
+		}
+		if strings.HasPrefix(rest, "{") {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid metric line: %s", line)
+			}
+			rest = rest[end+1:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid metric line: %s", line)
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric value: %s", line)
+		}
+		metrics[name] = v
+	}
+	return metrics, s.Err()
+}
+
+// Tip is the chain tip of a node as last scraped.
+type Tip struct {
+	Block uint64 `json:"block"`
+	Slot  uint64 `json:"slot"`
+	Epoch uint64 `json:"epoch"`
+	// ScrapedAt is when the tip was last scraped
+	ScrapedAt time.Time `json:"scraped_at"`
+	// AdvancedAt is when the block or the slot last increased
+	AdvancedAt time.Time `json:"advanced_at"`
+}
+
+// Tracker scrapes the metrics of a node and tracks when its tip advances.
+type Tracker struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	tip     Tip
+	err     error
+	lastTry time.Time
+}
+
+// NewTracker returns a tracker scraping url, the metrics endpoint of
+// cardano-node, with timeout.
+func NewTracker(url string, timeout time.Duration) *Tracker {
+	return &Tracker{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Scrape scrapes the metrics once and updates the tip.
+func (t *Tracker) Scrape(ctx context.Context) (Tip, error) {
+	metrics, err := t.scrape(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastTry = time.Now()
+	t.err = err
+	if err != nil {
+		return t.tip, err
+	}
+
+	block, slot := uint64(metrics[BlockNum]), uint64(metrics[SlotNum])
+	if t.tip.AdvancedAt.IsZero() || block > t.tip.Block || slot > t.tip.Slot {
+		t.tip.AdvancedAt = t.lastTry
+	}
+	t.tip.Block = block
+	t.tip.Slot = slot
+	t.tip.Epoch = uint64(metrics[EpochNum])
+	t.tip.ScrapedAt = t.lastTry
+	return t.tip, nil
+}
+
+func (t *Tracker) scrape(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scraping %s: %s", t.url, resp.Status)
+	}
+	metrics, err := Parse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := metrics[BlockNum]; !ok {
+		return nil, fmt.Errorf("scraping %s: no %s metric", t.url, BlockNum)
+	}
+	return metrics, nil
+}
+
+// Tip returns the last scraped tip, the zero Tip when none was scraped
+// yet, and the error of the last scrape.
+func (t *Tracker) Tip() (Tip, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tip, t.err
+}
+
+// LastScrape returns when the metrics were last scraped, successfully or
+// not.
+func (t *Tracker) LastScrape() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastTry
+}
+
+// Run scrapes the metrics every interval until ctx is done.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, _ = t.Scrape(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
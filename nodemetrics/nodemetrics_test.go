@@ -0,0 +1,106 @@
+package nodemetrics_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/nodemetrics"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+// metricsSample is an excerpt of the metrics served by cardano-node 1.26
+const metricsSample = `cardano_node_metrics_Forge_forge_about_to_lead_int 64
+cardano_node_metrics_blockNum_int %d
+cardano_node_metrics_density_real 4.9603e-2
+cardano_node_metrics_epoch_int 265
+cardano_node_metrics_slotInEpoch_int 293920
+cardano_node_metrics_slotNum_int %d
+cardano_node_metrics_txsInMempool_int 3
+rts_gc_bytes_copied 1.0838036176e10
+# TYPE go_goroutines gauge
+go_goroutines{instance="relay0"} 12
+`
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	m, err := nodemetrics.Parse(strings.NewReader(fmt.Sprintf(metricsSample, 5798765, 28857120)))
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(float64(5798765), m[nodemetrics.BlockNum])
+	a.Equal(float64(28857120), m[nodemetrics.SlotNum])
+	a.Equal(float64(265), m[nodemetrics.EpochNum])
+	a.Equal(0.049603, m["cardano_node_metrics_density_real"])
+	a.Equal(float64(12), m["go_goroutines"])
+
+	_, err = nodemetrics.Parse(strings.NewReader("cardano_node_metrics_blockNum_int abc\n"))
+	a.NotNil(err)
+}
+
+// metricsServer serves the metrics sample, the tip advances while advance
+// is set.
+func metricsServer(t *testing.T, advance *int32) *httptest.Server {
+	block := int64(5798765)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(advance) == 1 {
+			atomic.AddInt64(&block, 1)
+		}
+		b := atomic.LoadInt64(&block)
+		fmt.Fprintf(w, metricsSample, b, b*5)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTracker(t *testing.T) {
+	a := assert.New(t)
+	advance := int32(1)
+	srv := metricsServer(t, &advance)
+	tr := nodemetrics.NewTracker(srv.URL, time.Second)
+
+	_, err := tr.Tip()
+	a.Nil(err)
+	a.True(tr.LastScrape().IsZero())
+
+	first, err := tr.Scrape(context.Background())
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(uint64(5798766), first.Block)
+	a.Equal(uint64(5798766*5), first.Slot)
+	a.Equal(uint64(265), first.Epoch)
+
+	time.Sleep(time.Millisecond * 5)
+	second, err := tr.Scrape(context.Background())
+	a.Nil(err)
+	a.Equal(first.Block+1, second.Block)
+	a.True(second.AdvancedAt.After(first.AdvancedAt))
+
+	// a stalled tip keeps its advance time
+	atomic.StoreInt32(&advance, 0)
+	time.Sleep(time.Millisecond * 5)
+	third, err := tr.Scrape(context.Background())
+	a.Nil(err)
+	a.Equal(second.AdvancedAt, third.AdvancedAt)
+	a.True(third.ScrapedAt.After(second.ScrapedAt))
+
+	// scrape errors are reported and the last tip kept
+	srv.Close()
+	tip, err := tr.Scrape(context.Background())
+	a.NotNil(err)
+	a.Equal(third, tip)
+	_, err = tr.Tip()
+	a.NotNil(err)
+}
@@ -0,0 +1,191 @@
+package pathtrace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adakailabs/go-traceroute/traceroute"
+	"github.com/juju/errors"
+
+	"github.com/adakailabs/gocnode/geoip"
+)
+
+// Config holds the traceroute settings.
+type Config struct {
+	// MaxHops is the largest TTL probed
+	MaxHops int
+	// Timeout is how long to wait for late replies once every TTL was probed
+	Timeout time.Duration
+	// Count is the number of probes sent per TTL
+	Count int
+}
+
+// Hop is the router, or the target, that answered at a given distance.
+type Hop struct {
+	Distance int
+	IP       net.IP
+	RTT      time.Duration
+	Geo      geoip.Info
+}
+
+// Path is the result of tracing the route to a peer.
+type Path struct {
+	Target net.IP
+	// Reached is true when the target itself answered
+	Reached bool
+	// HopCount is the distance to the target, or to the last responding
+	// hop when the target was not reached
+	HopCount int
+	Hops     []Hop
+	// ASPath lists the autonomous systems crossed, in order, when a
+	// GeoIP/ASN db is available
+	ASPath []uint
+}
+
+// LastHop returns the farthest hop that answered, nil if none did.
+func (p *Path) LastHop() *Hop {
+	if len(p.Hops) == 0 {
+		return nil
+	}
+	return &p.Hops[len(p.Hops)-1]
+}
+
+// Transit returns the AS path without the target's own AS, peers sharing
+// a transit are reached through the same upstream networks.
+func (p *Path) Transit() string {
+	asPath := p.ASPath
+	if p.Reached && len(asPath) > 0 {
+		asPath = asPath[:len(asPath)-1]
+	}
+	s := make([]string, len(asPath))
+	for i, asn := range asPath {
+		s[i] = fmt.Sprintf("AS%d", asn)
+	}
+	return strings.Join(s, " ")
+}
+
+func (p *Path) String() string {
+	last := "none"
+	if h := p.LastHop(); h != nil {
+		last = h.IP.String()
+	}
+	return fmt.Sprintf("target: %s reached: %v hops: %d last hop: %s as path: %s",
+		p.Target, p.Reached, p.HopCount, last, p.Transit())
+}
+
+// NewPath builds the path to target from the replies of a trace, geo may
+// be nil.
+func NewPath(target net.IP, replies []*traceroute.Reply, geo *geoip.DB) *Path {
+	p := &Path{Target: target}
+
+	byDistance := make(map[int]*Hop)
+	for _, r := range replies {
+		if r.IP.Equal(target) && (!p.Reached || r.Hops < p.HopCount) {
+			p.Reached = true
+			p.HopCount = r.Hops
+		}
+		h, ok := byDistance[r.Hops]
+		if !ok {
+			byDistance[r.Hops] = &Hop{Distance: r.Hops, IP: r.IP, RTT: r.RTT}
+			continue
+		}
+		if r.RTT < h.RTT {
+			h.RTT = r.RTT
+		}
+	}
+
+	for _, h := range byDistance {
+		if p.Reached && h.Distance > p.HopCount {
+			continue
+		}
+		p.Hops = append(p.Hops, *h)
+	}
+	sort.Slice(p.Hops, func(i, j int) bool {
+		return p.Hops[i].Distance < p.Hops[j].Distance
+	})
+	if !p.Reached && len(p.Hops) > 0 {
+		p.HopCount = p.Hops[len(p.Hops)-1].Distance
+	}
+
+	if geo == nil {
+		return p
+	}
+	for i := range p.Hops {
+		info, ok := geo.Lookup(p.Hops[i].IP)
+		if !ok {
+			continue
+		}
+		p.Hops[i].Geo = info
+		if info.ASN == 0 {
+			continue
+		}
+		if n := len(p.ASPath); n == 0 || p.ASPath[n-1] != info.ASN {
+			p.ASPath = append(p.ASPath, info.ASN)
+		}
+	}
+	return p
+}
+
+// Tracer traces the routes to peers, it can trace several of them at the
+// same time. It sends raw IP packets so it needs the CAP_NET_RAW
+// capability.
+type Tracer struct {
+	tracer *traceroute.Tracer
+	geo    *geoip.DB
+}
+
+// New returns a tracer, geo may be nil.
+func New(c Config, geo *geoip.DB) *Tracer {
+	tc := traceroute.DefaultConfig
+	if c.MaxHops > 0 {
+		tc.MaxHops = c.MaxHops
+	}
+	if c.Timeout > 0 {
+		tc.Timeout = c.Timeout
+	}
+	if c.Count > 0 {
+		tc.Count = c.Count
+	}
+	return &Tracer{
+		tracer: &traceroute.Tracer{Config: tc},
+		geo:    geo,
+	}
+}
+
+// Trace traces the route to ip, only IPv4 is supported.
+func (t *Tracer) Trace(ctx context.Context, ip net.IP) (*Path, error) {
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("cannot trace %s: only IPv4 is supported", ip)
+	}
+	ip = ip.To4()
+
+	replies := make([]*traceroute.Reply, 0, t.tracer.MaxHops)
+	err := t.tracer.Trace(ctx, ip, func(r *traceroute.Reply) {
+		replies = append(replies, r)
+	})
+	if err != nil && err != context.DeadlineExceeded && err != context.Canceled {
+		return nil, errors.Annotatef(err, "tracing %s", ip)
+	}
+	return NewPath(ip, replies, t.geo), nil
+}
+
+// TraceHost resolves host and traces the route to its first IPv4 address.
+func (t *Tracer) TraceHost(ctx context.Context, host string) (*Path, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s has no IPv4 address", host)
+	}
+	return t.Trace(ctx, ips[0])
+}
+
+// Close releases the raw socket.
+func (t *Tracer) Close() {
+	t.tracer.Close()
+}
@@ -0,0 +1,76 @@
+package pathtrace_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adakailabs/go-traceroute/traceroute"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/geoip"
+	"github.com/adakailabs/gocnode/pathtrace"
+)
+
+const testDB = `10.1.0.0	10.1.255.255	100	US	AS-ONE
+10.2.0.0	10.2.255.255	200	US	AS-TWO
+10.3.0.0	10.3.255.255	300	DE	AS-THREE
+`
+
+func TestMain(m *testing.M) {
+	// call flag.Parse() here if TestMain uses flags
+	os.Exit(m.Run())
+}
+
+func reply(ip string, hops int, rtt time.Duration) *traceroute.Reply {
+	return &traceroute.Reply{IP: net.ParseIP(ip).To4(), Hops: hops, RTT: rtt}
+}
+
+func TestNewPath(t *testing.T) {
+	a := assert.New(t)
+
+	geoPath := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if !a.Nil(ioutil.WriteFile(geoPath, []byte(testDB), 0o600)) {
+		t.FailNow()
+	}
+	db, err := geoip.Open(geoPath)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	target := net.ParseIP("10.3.0.1").To4()
+	replies := []*traceroute.Reply{
+		reply("192.168.1.1", 1, time.Millisecond*2),
+		reply("10.1.0.1", 2, time.Millisecond*5),
+		reply("10.1.0.1", 2, time.Millisecond*4),
+		reply("10.1.0.9", 3, time.Millisecond*6),
+		reply("10.2.0.1", 4, time.Millisecond*8),
+		reply("10.3.0.1", 6, time.Millisecond*12),
+		reply("10.3.0.1", 5, time.Millisecond*10),
+	}
+
+	p := pathtrace.NewPath(target, replies, db)
+	a.True(p.Reached)
+	a.Equal(5, p.HopCount)
+	a.Len(p.Hops, 5)
+	a.Equal(time.Millisecond*4, p.Hops[1].RTT)
+	a.Equal([]uint{100, 200, 300}, p.ASPath)
+	a.Equal("AS100 AS200", p.Transit())
+	if a.NotNil(p.LastHop()) {
+		a.True(target.Equal(p.LastHop().IP))
+	}
+
+	// the target does not answer, the path ends at the last responding hop
+	p = pathtrace.NewPath(target, replies[:5], nil)
+	a.False(p.Reached)
+	a.Equal(4, p.HopCount)
+	a.Equal("10.2.0.1", p.LastHop().IP.String())
+	a.Empty(p.ASPath)
+
+	p = pathtrace.NewPath(target, nil, db)
+	a.False(p.Reached)
+	a.Nil(p.LastHop())
+}
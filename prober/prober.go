@@ -0,0 +1,84 @@
+package prober
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Config holds the limits of a probing run.
+type Config struct {
+	// Parallelism is the maximum number of probes running at the same time
+	Parallelism int
+	// Timeout bounds each individual probe
+	Timeout time.Duration
+	// Progress, when set, is called after each probe completes
+	Progress func(done, total int)
+}
+
+// Prober runs probes through a bounded pool of workers.
+type Prober struct {
+	Config
+}
+
+func New(c Config) *Prober {
+	if c.Parallelism <= 0 {
+		c.Parallelism = 1
+	}
+	return &Prober{Config: c}
+}
+
+// Run calls probe once for every index in [0, n), with at most Parallelism
+// probes in flight. Each probe gets a context that expires after Timeout
+// and is cancelled with ctx. Once ctx is done no new probes are started
+// and Run waits for the running ones before returning the number of probes
+// that completed.
+//
+// probe is called concurrently, it must only write state owned by its
+// index.
+func (p *Prober) Run(ctx context.Context, n int, probe func(ctx context.Context, i int)) int {
+	jobs := make(chan int)
+	wg := &sync.WaitGroup{}
+	mu := sync.Mutex{}
+	done := 0
+
+	workers := p.Parallelism
+	if workers > n {
+		workers = n
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				pctx, cancel := ctx, context.CancelFunc(func() {})
+				if p.Timeout > 0 {
+					pctx, cancel = context.WithTimeout(ctx, p.Timeout)
+				}
+				probe(pctx, i)
+				cancel()
+
+				mu.Lock()
+				done++
+				if p.Progress != nil {
+					p.Progress(done, n)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+schedule:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break schedule
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return done
+}
@@ -0,0 +1,77 @@
+package prober_test
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/prober"
+)
+
+func TestMain(m *testing.M) {
+	// call flag.Parse() here if TestMain uses flags
+	os.Exit(m.Run())
+}
+
+func TestRunParallelism(t *testing.T) {
+	a := assert.New(t)
+
+	var running, maxRunning int32
+	var lastDone, lastTotal int
+	p := prober.New(prober.Config{
+		Parallelism: 3,
+		Timeout:     time.Second,
+		Progress: func(done, total int) {
+			lastDone, lastTotal = done, total
+		},
+	})
+
+	results := make([]int, 20)
+	done := p.Run(context.Background(), len(results), func(ctx context.Context, i int) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if now <= m || atomic.CompareAndSwapInt32(&maxRunning, m, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 5)
+		results[i] = i * 2
+		atomic.AddInt32(&running, -1)
+	})
+
+	a.Equal(20, done)
+	a.Equal(20, lastDone)
+	a.Equal(20, lastTotal)
+	a.True(maxRunning <= 3)
+	for i := range results {
+		a.Equal(i*2, results[i])
+	}
+}
+
+func TestRunTimeouts(t *testing.T) {
+	a := assert.New(t)
+
+	p := prober.New(prober.Config{Parallelism: 2, Timeout: time.Millisecond * 10})
+
+	// every probe waits for its own timeout
+	start := time.Now()
+	done := p.Run(context.Background(), 4, func(ctx context.Context, i int) {
+		<-ctx.Done()
+	})
+	a.Equal(4, done)
+	a.True(time.Since(start) < time.Second)
+
+	// the global deadline stops scheduling new probes
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*30)
+	defer cancel()
+	p = prober.New(prober.Config{Parallelism: 1})
+	done = p.Run(ctx, 100, func(ctx context.Context, i int) {
+		time.Sleep(time.Millisecond * 10)
+	})
+	a.True(done < 100)
+}
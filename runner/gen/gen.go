@@ -1,8 +1,6 @@
 package gen
 
 import (
-	"os/exec"
-
 	"github.com/adakailabs/gocnode/runner/process"
 
 	"github.com/adakailabs/gocnode/config"
@@ -10,15 +8,11 @@ import (
 )
 
 type R struct {
-	C        *config.C
-	NodeC    *config.Node
-	NodeID   int
-	Log      *zap.SugaredLogger
-	Cmd1Args []string
-	Cmd1Path string
-	Cmd0Args []string
-	Cmd0Path string
-	Cmd0     *exec.Cmd
-	Cmd1     *exec.Cmd
+	C      *config.C
+	NodeC  *config.Node
+	NodeID int
+	Log    *zap.SugaredLogger
+	// Services are the processes the runner runs
+	Services []*Service
 	P        process.P
 }
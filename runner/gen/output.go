@@ -0,0 +1,70 @@
+package gen
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/adakailabs/gocnode/config"
+	l "github.com/adakailabs/gocnode/logger"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+// InitRouter routes the output of the runner's processes following the
+// configured log rules.
+func (r *R) InitRouter() (err error) {
+	r.P.Router, err = process.NewRouter(r.C.LogRules)
+	return err
+}
+
+// InitLogFiles writes the raw output of the services that lf enables to
+// rotated files.
+func (r *R) InitLogFiles(lf config.LogFiles, services ...string) error {
+	r.P.Files = make(map[string]io.Writer)
+	for _, service := range services {
+		if !lf.ForService(service) {
+			continue
+		}
+		rot, err := l.NewRotator(l.RotateConfig{
+			Path:       fmt.Sprintf("%s/%s.log", lf.Dir, service),
+			MaxSize:    int64(lf.MaxSizeMB) * 1024 * 1024,
+			MaxAge:     lf.MaxAge,
+			MaxBackups: int(lf.MaxBackups),
+			Retention:  lf.Retention,
+			Compress:   lf.Compress,
+		})
+		if err != nil {
+			r.CloseOutput()
+			return err
+		}
+		r.P.Files[service] = rot
+	}
+	return nil
+}
+
+// WatchLogRules applies the log rules of the config file when it changes,
+// it runs as a supervised service until ctx is done.
+func (r *R) WatchLogRules(ctx context.Context) error {
+	r.C.WatchLogRules(ctx, func(rules map[string][]config.LogRule) {
+		if err := r.P.Router.SetRules(rules); err != nil {
+			r.Log.Errorf("log rules not applied: %s", err.Error())
+		}
+	})
+	return nil
+}
+
+// CloseOutput reports how many lines each log rule matched and closes the
+// files the output is written to.
+func (r *R) CloseOutput() {
+	for name, count := range r.P.Router.Counts() {
+		r.Log.Infof("log rule %s matched %d lines", name, count)
+	}
+	r.P.Router.Close()
+	for service, w := range r.P.Files {
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				r.Log.Errorf("closing %s output file: %s", service, err.Error())
+			}
+		}
+	}
+}
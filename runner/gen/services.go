@@ -0,0 +1,157 @@
+package gen
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+	"syscall"
+
+	"github.com/juju/errors"
+	"github.com/k0kubun/pp"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+// Service is a command run by a runner: the main process of a node or one
+// of its sidecars.
+type Service struct {
+	Name string
+	Path string
+	Args []string
+	// Env are KEY=value variables added to the environment of gocnode
+	Env []string
+	// Dir is the working directory, the one of gocnode when empty
+	Dir string
+	// Deps are the services this one is started after, once they are
+	// ready, and stopped before
+	Deps []string
+	// StopBefore are the services this one is stopped before, without
+	// waiting for them to start
+	StopBefore []string
+	// Policy is the default restart policy, always when empty
+	Policy string
+	// Stop is how the service is stopped
+	Stop process.Stop
+	// Ready, when set, reports whether the service is ready
+	Ready func(ctx context.Context) error
+}
+
+// AddService adds s to the services of the runner, it returns s so that
+// its args can be completed later.
+func (r *R) AddService(s Service) *Service {
+	if s.Policy == "" {
+		s.Policy = process.RestartAlways
+	}
+	r.Services = append(r.Services, &s)
+	return &s
+}
+
+// Service returns the service name, nil when the runner has none.
+func (r *R) Service(name string) *Service {
+	for _, s := range r.Services {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// ServiceNames returns the names of the services, in the order they were
+// added.
+func (r *R) ServiceNames() []string {
+	names := make([]string, 0, len(r.Services))
+	for _, s := range r.Services {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// ConfigureServices applies the configured executable paths, extra
+// arguments, environment and working directory to the services and adds
+// the configured services the runner does not know, execs is keyed by
+// service name. It is called once the runner set the arguments of its
+// services.
+func (r *R) ConfigureServices(execs map[string]config.ServiceExec) {
+	names := make([]string, 0, len(execs))
+	for name := range execs {
+		names = append(names, name)
+	}
+	// the declared services are added in a stable order
+	sort.Strings(names)
+	for _, name := range names {
+		if r.Service(name) != nil {
+			continue
+		}
+		e := execs[name]
+		stop := process.Stop{Signal: syscall.SIGTERM}
+		if r.C != nil {
+			stop.GracePeriod = r.C.Shutdown.SidecarGracePeriod
+		}
+		r.AddService(Service{
+			Name:  name,
+			Path:  name,
+			Args:  append([]string{}, e.Args...),
+			Deps:  e.Deps,
+			Stop:  stop,
+			Ready: readiness(e.Ready),
+		})
+	}
+
+	for _, s := range r.Services {
+		e, ok := execs[s.Name]
+		if !ok {
+			continue
+		}
+		if e.Path != "" {
+			s.Path = e.Path
+		}
+		if e.Dir != "" {
+			s.Dir = e.Dir
+		}
+		s.Args = append(s.Args, e.ExtraArgs...)
+		s.Env = append(s.Env, e.Env...)
+	}
+}
+
+// readiness returns the readiness check configured by ready, nil when none
+// is.
+func readiness(ready config.ServiceReady) func(ctx context.Context) error {
+	switch {
+	case ready.File != "":
+		return process.ReadyFile(ready.File)
+	case ready.TCP != "":
+		return process.ReadyTCP(ready.TCP)
+	case ready.HTTP != "":
+		return process.ReadyHTTP(ready.HTTP)
+	}
+	return nil
+}
+
+// CheckServices checks that the executables of the services exist.
+func (r *R) CheckServices() error {
+	for _, s := range r.Services {
+		if _, err := exec.LookPath(s.Path); err != nil {
+			return errors.Annotatef(err, "service %s", s.Name)
+		}
+	}
+	return nil
+}
+
+// Supervise adds the services of the runner to sup.
+func (r *R) Supervise(sup *process.Supervisor) {
+	for _, s := range r.Services {
+		s := s
+		r.Log.Infof("%s: %s", s.Name, pp.Sprint(s.Args))
+		sup.Add(process.Service{
+			Name:       s.Name,
+			Policy:     s.Policy,
+			Deps:       s.Deps,
+			StopBefore: s.StopBefore,
+			Ready:      s.Ready,
+			Run: func(ctx context.Context) error {
+				return r.P.ExecSpec(ctx, process.Spec{Name: s.Name, Path: s.Path, Args: s.Args, Env: s.Env, Dir: s.Dir}, s.Stop)
+			},
+		})
+	}
+}
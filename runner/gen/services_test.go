@@ -0,0 +1,123 @@
+package gen_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/runner/gen"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+func TestServices(t *testing.T) {
+	a := assert.New(t)
+	fake := process.NewFakeExecutor()
+	r := &gen.R{Log: zap.NewNop().Sugar()}
+	r.P.Log = r.Log
+	r.P.Executor = fake
+
+	ready := make(chan struct{})
+	r.AddService(gen.Service{Name: "node", Path: "cardano-node", Args: []string{"run"},
+		Ready: func(ctx context.Context) error {
+			select {
+			case <-ready:
+				return nil
+			default:
+				return context.DeadlineExceeded
+			}
+		}})
+	r.AddService(gen.Service{Name: "exporter", Path: "node_exporter", Deps: []string{"node"},
+		Env: []string{"GOMAXPROCS=1"}, Dir: "/tmp"})
+	r.AddService(gen.Service{Name: "sidecar", Path: "sidecar", Deps: []string{"exporter"}})
+
+	// the args can be completed after the service is added
+	node := r.Service("node")
+	node.Args = append(node.Args, "--port", "3001")
+	a.Nil(r.Service("missing"))
+	a.Equal([]string{"node", "exporter", "sidecar"}, r.ServiceNames())
+
+	sup := process.NewSupervisor(r.Log, config.Supervisor{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxRestarts:    3,
+		Window:         time.Minute,
+		ReadyInterval:  time.Millisecond,
+	})
+	r.Supervise(sup)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sup.Run(ctx) }()
+
+	p := <-fake.Started()
+	a.Equal(process.Spec{Name: "node", Path: "cardano-node", Args: []string{"run", "--port", "3001"}}, p.Spec)
+	select {
+	case p = <-fake.Started():
+		t.Fatalf("%s started before node is ready", p.Spec.Name)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// once node is ready the other services start in order
+	close(ready)
+	p = <-fake.Started()
+	a.Equal(process.Spec{Name: "exporter", Path: "node_exporter", Env: []string{"GOMAXPROCS=1"}, Dir: "/tmp"}, p.Spec)
+	p = <-fake.Started()
+	a.Equal("sidecar", p.Spec.Name)
+
+	// the services are restarted with the always policy by default
+	p.Exit(nil)
+	p = <-fake.Started()
+	a.Equal("sidecar", p.Spec.Name)
+
+	cancel()
+	a.Nil(<-done)
+	for _, p := range fake.Processes() {
+		a.False(p.Status().Running)
+	}
+}
+
+func TestConfigureServices(t *testing.T) {
+	a := assert.New(t)
+	r := &gen.R{Log: zap.NewNop().Sugar()}
+	r.AddService(gen.Service{Name: "cardano-node", Path: "cardano-node", Args: []string{"run"}, Env: []string{"A=1"}})
+	r.AddService(gen.Service{Name: "node_exporter", Path: "node_exporter"})
+
+	r.ConfigureServices(map[string]config.ServiceExec{
+		"cardano-node": {Path: "sh", ExtraArgs: []string{"--validate-db"}, Env: []string{"GHCRTS=-T"}},
+		"db-sync": {Path: "sh", Args: []string{"--config", "db-sync.yaml"}, ExtraArgs: []string{"-v"}, Dir: "/tmp",
+			Deps: []string{"cardano-node"}, Ready: config.ServiceReady{File: "/nonexistent/db-sync.ready"}},
+	})
+	cn := r.Service("cardano-node")
+	a.Equal("sh", cn.Path)
+	a.Equal([]string{"run", "--validate-db"}, cn.Args)
+	a.Equal([]string{"A=1", "GHCRTS=-T"}, cn.Env)
+	a.Equal("node_exporter", r.Service("node_exporter").Path)
+
+	// services gocnode does not know are declared
+	a.Equal([]string{"cardano-node", "node_exporter", "db-sync"}, r.ServiceNames())
+	ds := r.Service("db-sync")
+	a.Equal("sh", ds.Path)
+	a.Equal([]string{"--config", "db-sync.yaml", "-v"}, ds.Args)
+	a.Equal("/tmp", ds.Dir)
+	a.Equal([]string{"cardano-node"}, ds.Deps)
+	if a.NotNil(ds.Ready) {
+		a.NotNil(ds.Ready(context.Background()))
+	}
+
+	r.Service("node_exporter").Path = "/nonexistent/node_exporter"
+	err := r.CheckServices()
+	if a.NotNil(err) {
+		a.Contains(err.Error(), "service node_exporter")
+	}
+	r.Service("node_exporter").Path = "sh"
+	a.Nil(r.CheckServices())
+}
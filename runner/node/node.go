@@ -1,8 +1,10 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/juju/errors"
@@ -13,14 +15,36 @@ import (
 	"github.com/adakailabs/gocnode/cardanocfg"
 
 	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/health"
+	"github.com/adakailabs/gocnode/nodelog"
+	"github.com/adakailabs/gocnode/nodemetrics"
 	"github.com/adakailabs/gocnode/runner/gen"
+	"github.com/adakailabs/gocnode/runner/process"
 	"github.com/adakailabs/gocnode/topologyupdater"
+	"github.com/adakailabs/gocnode/watchdog"
 	"github.com/k0kubun/pp"
 )
 
+// peerFailuresQueue is how many peer failures wait for the demoter before
+// new ones are dropped
+const peerFailuresQueue = 256
+
+// Names of the services of a node
+const (
+	cardanoNode  = config.ServiceCardanoNode
+	nodeExporter = config.ServiceNodeExporter
+)
+
 type R struct {
 	gen.R
-	cnargs cnodeArgs
+	cnargs     cnodeArgs
+	downloader *cardanocfg.Downloader
+	Supervisor *process.Supervisor
+	Tracker    *nodemetrics.Tracker
+
+	// peerFailures queues the peer failures reported by cardano-node for
+	// the demoter
+	peerFailures chan string
 }
 
 type cnodeArgs struct {
@@ -58,6 +82,10 @@ func (r *R) Init(conf *config.C, nodeID int, isProducer, passive bool) (err erro
 		return err
 	}
 	r.P.Log = r.Log
+	r.P.Events = nodelog.NewBus()
+	if err = r.InitRouter(); err != nil {
+		return err
+	}
 	r.NodeID = nodeID
 
 	if isProducer {
@@ -80,7 +108,9 @@ func (r *R) Init(conf *config.C, nodeID int, isProducer, passive bool) (err erro
 	return err
 }
 
-func (r *R) newArgs() (cnodeArgs, error) {
+// newArgs sets the arguments of cardano-node, downloading its configuration
+// and topology files, the download is abandoned when ctx is done.
+func (r *R) newArgs(ctx context.Context) (cnodeArgs, error) {
 	r.cnargs = cnodeArgs{}
 	r.cnargs.DatabasePathS = "--database-path"
 	r.cnargs.SocketPathS = "--socket-path"
@@ -108,7 +138,13 @@ func (r *R) newArgs() (cnodeArgs, error) {
 	if err != nil {
 		return r.cnargs, err
 	}
-	r.cnargs.NodeConfig, r.cnargs.NodeTopology, _, _, _ = d.DownloadConfigFiles()
+	files, err := d.DownloadConfigFiles(ctx)
+	if err != nil {
+		return r.cnargs, err
+	}
+	r.cnargs.NodeConfig = files.ConfigJSON
+	r.cnargs.NodeTopology = files.Topology
+	r.downloader = d
 
 	return r.cnargs, nil
 }
@@ -160,8 +196,9 @@ func (r *R) setCheckDBPath() error {
 	return nil
 }
 
-func (r *R) setCMD0Args() {
-	r.Cmd0Args = append(r.Cmd0Args,
+func (r *R) setCNodeArgs() {
+	cn := r.Service(cardanoNode)
+	cn.Args = append(cn.Args,
 		r.cnargs.DatabasePathS,
 		r.cnargs.DatabasePath,
 		r.cnargs.SocketPathS,
@@ -177,7 +214,7 @@ func (r *R) setCMD0Args() {
 	)
 
 	if r.NodeC.IsProducer && !r.NodeC.PassiveMode {
-		r.Cmd0Args = append(r.Cmd0Args,
+		cn.Args = append(cn.Args,
 			r.cnargs.KesKeyS,
 			r.cnargs.KesKey,
 			r.cnargs.VrfKeyS,
@@ -186,40 +223,35 @@ func (r *R) setCMD0Args() {
 			r.cnargs.OpCert,
 		)
 	}
-
-	r.Log.Info(pp.Sprint(r.Cmd0Args))
+	cn.Args = append(cn.Args, r.NodeC.RTSArgs()...)
+	// cardano-node is ready once it opened its socket
+	cn.Ready = process.ReadyFile(r.cnargs.SocketPath)
 }
 
-func (r *R) setCMD1Args() {
-	r.Cmd1Args = append(r.Cmd1Args,
+func (r *R) setExporterArgs() {
+	exp := r.Service(nodeExporter)
+	exp.Args = append(exp.Args,
 		fmt.Sprintf("--web.listen-address=:%d", r.NodeC.PromeNExpPort))
-	r.Log.Info(pp.Sprint(r.Cmd1Args))
-}
-
-func (r *R) runCNode(cer chan error) {
-	time.Sleep(time.Second * 2)
-	if er := r.P.Exec("cardano-node", r.Cmd0Path, r.Cmd0Args, r.Cmd0); er != nil {
-		cer <- er
-	}
-}
-
-func (r *R) runExporter(cer chan error) {
-	if er := r.P.Exec("node_exporter", r.Cmd1Path, r.Cmd1Args, r.Cmd1); er != nil {
-		cer <- er
-	}
+	exp.Ready = process.ReadyTCP(fmt.Sprintf("127.0.0.1:%d", r.NodeC.PromeNExpPort))
 }
 
-func (r *R) runTopologyUpdater(cer chan error) {
-	ticker := time.NewTicker(time.Hour)
+func (r *R) runTopologyUpdater(ctx context.Context) error {
 	if r.NodeC.IsProducer {
-		return
+		return nil
 	}
 	tu, er := topologyupdater.New(r.C, r.NodeID)
 	if er != nil {
-		cer <- er
+		return er
 	}
 
-	for range ticker.C {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
 		code, e := tu.Ping()
 		if e != nil {
 			r.Log.Error(e.Error())
@@ -232,31 +264,99 @@ func (r *R) runTopologyUpdater(cer chan error) {
 	}
 }
 
-func (r *R) StartCnode() (err error) {
+func (r *R) runTracker(ctx context.Context) error {
+	return r.Tracker.Run(ctx, r.NodeC.Health.ScrapeInterval)
+}
+
+// restartCNode restarts cardano-node, for the watchdog.
+func (r *R) restartCNode() error {
+	return r.Supervisor.Restart(cardanoNode)
+}
+
+// peerFailed hands the peers cardano-node fails to reach over to the
+// demoter, it is called while reading cardano-node's output and never
+// blocks.
+func (r *R) peerFailed(e nodelog.Event) {
+	peer, failure, ok := nodelog.PeerFailure(e)
+	if !ok {
+		return
+	}
+	r.Log.Errorf("%s: %s", failure, peer)
+	select {
+	case r.peerFailures <- peer:
+	default:
+		r.Log.Warnf("demoter is busy, dropping the failure of peer %s", peer)
+	}
+}
+
+// runDemoter reports the queued peer failures to the downloader.
+func (r *R) runDemoter(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case peer := <-r.peerFailures:
+			r.downloader.PeerFailed(peer)
+		}
+	}
+}
+
+func (r *R) runPeerFilesWatcher(ctx context.Context) error {
+	r.downloader.WatchPeerFiles(ctx)
+	return nil
+}
+
+// StartCnode runs the services of the node, cardano-node and its sidecars,
+// with the topology updater, the peer files watcher, the peer demoter and,
+// when enabled, the tip watchdog under a supervisor. It returns when one of them is crash
+// looping or, once every process stopped, when ctx is done. The services
+// that depend on cardano-node wait for its socket to be open before they
+// start, and are stopped before it, node_exporter is only stopped before
+// it.
+func (r *R) StartCnode(ctx context.Context) (err error) {
 	r.Log.Info("starting gocnode")
 
-	r.cnargs, err = r.newArgs()
+	r.cnargs, err = r.newArgs(ctx)
 	if err != nil {
 		return err
 	}
 
-	r.setCMD0Args()
+	r.setCNodeArgs()
 
 	pp.Println(r.cnargs)
 
-	r.setCMD1Args()
+	r.setExporterArgs()
+	r.ConfigureServices(r.NodeC.Services)
 
-	cer := make(chan error)
+	if err = r.InitLogFiles(r.NodeC.LogFiles, r.ServiceNames()...); err != nil {
+		return err
+	}
+	defer r.CloseOutput()
 
+	r.Supervisor = process.NewSupervisor(r.Log, r.C.Supervisor)
+	r.Tracker = nodemetrics.NewTracker(r.NodeC.Health.MetricsURL, r.NodeC.Health.MetricsTimeout)
+	checker := health.New(r.Log, r.NodeC, r.cnargs.SocketPath, r.Supervisor.Status, r.Tracker)
 	if !r.NodeC.TestMode {
-		go r.runExporter(cer)
-		go r.runCNode(cer)
-		go r.runTopologyUpdater(cer)
+		if err = r.CheckServices(); err != nil {
+			return err
+		}
+		cnode := []string{cardanoNode}
+		r.peerFailures = make(chan string, peerFailuresQueue)
+		r.P.Events.Subscribe(r.peerFailed)
+		r.Supervise(r.Supervisor)
+		r.Supervisor.Add(process.Service{Name: "peer_demoter", Policy: process.RestartOnFailure, Run: r.runDemoter})
+		r.Supervisor.Add(process.Service{Name: "topology_updater", Policy: process.RestartOnFailure, Deps: cnode, Run: r.runTopologyUpdater})
+		r.Supervisor.Add(process.Service{Name: "peer_files_watcher", Policy: process.RestartOnFailure, Deps: cnode, Run: r.runPeerFilesWatcher})
+		r.Supervisor.Add(process.Service{Name: "log_rules_watcher", Policy: process.RestartOnFailure, Run: r.WatchLogRules})
+		r.Supervisor.Add(process.Service{Name: "metrics_tracker", Policy: process.RestartOnFailure, Deps: cnode, Run: r.runTracker})
+		r.Supervisor.Add(process.Service{Name: "health_server", Policy: process.RestartOnFailure, Run: checker.Serve})
+		if r.NodeC.Watchdog.Enabled {
+			wd := watchdog.New(r.Log, r.NodeC, r.Tracker, r.downloader.DownloadAndSetTopologyFile, r.restartCNode)
+			r.Supervisor.Add(process.Service{Name: "watchdog", Policy: process.RestartOnFailure, Deps: cnode, Run: wd.Run})
+		}
 	}
 
-	err = <-cer
-
-	return err
+	return r.Supervisor.Run(ctx)
 }
 
 func NewCardanoNodeRunner(conf *config.C, nodeID int, isProducer, passive bool) (r *R, err error) {
@@ -265,12 +365,22 @@ func NewCardanoNodeRunner(conf *config.C, nodeID int, isProducer, passive bool)
 	if err != nil {
 		return r, err
 	}
-	r.Cmd0Path = "cardano-node"
-	r.Cmd0Args = make([]string, 1, 10)
-	r.Cmd0Args[0] = "run"
-
-	r.Cmd1Path = "node_exporter"
-	r.Cmd1Args = make([]string, 0, 10)
+	// cardano-node is stopped with SIGINT so that it closes its ChainDB
+	// cleanly and does not revalidate it on the next start
+	r.AddService(gen.Service{
+		Name: cardanoNode,
+		Path: "cardano-node",
+		Args: []string{"run"},
+		Stop: process.Stop{Signal: syscall.SIGINT, GracePeriod: r.C.Shutdown.GracePeriod},
+	})
+	r.AddService(gen.Service{
+		Name: nodeExporter,
+		Path: "node_exporter",
+		// host metrics are exported while cardano-node revalidates its
+		// ChainDB, node_exporter starts right away
+		StopBefore: []string{cardanoNode},
+		Stop:       process.Stop{Signal: syscall.SIGTERM, GracePeriod: r.C.Shutdown.SidecarGracePeriod},
+	})
 
 	return r, err
 }
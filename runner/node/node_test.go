@@ -0,0 +1,119 @@
+package node_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/runner/node"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+const nodeConfig = `
+config_uri: %s
+secrets_path: /secrets
+producers:
+  - pool: "test"
+    host: "producer.example.com"
+    network: "mainnet"
+    root_dir: %s
+    backup_dir: %s
+    rts_options: ["-N2"]
+    services:
+      cardano-node:
+        path: sh
+      node_exporter:
+        path: sh
+relays:
+  - pool: "test"
+    host: "127.0.0.1"
+    network: "mainnet"
+    port: 3001
+`
+
+func TestStartCnode(t *testing.T) {
+	a := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"networkMagic": 764824073}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "producer")
+	path := filepath.Join(dir, "gocnode.yaml")
+	conf := fmt.Sprintf(nodeConfig, srv.URL, root, filepath.Join(dir, "backup"))
+	if !a.Nil(ioutil.WriteFile(path, []byte(conf), 0o600)) {
+		t.FailNow()
+	}
+	c, err := config.New(path, true, "debug")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	r, err := node.NewCardanoNodeRunner(c, 0, true, false)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	fake := process.NewFakeExecutor()
+	r.P.Executor = fake
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.StartCnode(ctx) }()
+
+	// node_exporter does not wait for cardano-node to be ready
+	procs := make(map[string]*process.FakeProcess)
+	for len(procs) < 2 {
+		select {
+		case p := <-fake.Started():
+			procs[p.Spec.Name] = p
+		case <-time.After(time.Second * 10):
+			t.Fatalf("started: %v", procs)
+		}
+	}
+
+	cn := procs[config.ServiceCardanoNode]
+	if !a.NotNil(cn) {
+		t.FailNow()
+	}
+	a.Equal("sh", cn.Spec.Path)
+	args := strings.Join(cn.Spec.Args, " ")
+	a.True(strings.HasPrefix(args, "run --database-path "+filepath.Join(root, "db")), args)
+	a.Contains(args, "--socket-path "+filepath.Join(root, "db", "node.socket"))
+	a.Contains(args, "--shelley-kes-key /secrets/node_kes.key")
+	a.True(strings.HasSuffix(args, "+RTS -N2 -RTS"), args)
+
+	exp := procs[config.ServiceNodeExporter]
+	if !a.NotNil(exp) {
+		t.FailNow()
+	}
+	a.Equal([]string{"--web.listen-address=:9100"}, exp.Spec.Args)
+
+	// node_exporter is stopped with SIGTERM before cardano-node gets SIGINT
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 10):
+		t.Fatal("StartCnode did not return")
+	}
+	a.Equal([]os.Signal{syscall.SIGTERM}, exp.Signals())
+	a.Equal([]os.Signal{syscall.SIGINT}, cn.Signals())
+	a.False(cn.Status().ExitedAt.Before(exp.Status().ExitedAt))
+}
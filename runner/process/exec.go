@@ -1,142 +1,120 @@
 package process
 
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"io"
-	"os/exec"
-	"regexp"
-	"strings"
+	"os"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/juju/errors"
+
+	"github.com/adakailabs/gocnode/nodelog"
 )
 
 type P struct {
 	Log *zap.SugaredLogger
-}
 
-func (r *P) Exec(name, cmdPath string, cmdArgs []string, cmd *exec.Cmd) (err error) {
-	var ioBufferStdOut io.ReadCloser
-	var ioBufferStdErr io.ReadCloser
+	// Events, when set, gets the events parsed from the output of the
+	// commands.
+	Events *nodelog.Bus
 
-	r.Log.Info("Cmd0 args: ", cmdPath, cmdArgs)
-	cmd = exec.Command(cmdPath, cmdArgs...)
+	// Router routes the output of the commands, a nil Router prints it
+	Router *Router
 
-	// Get a pipe to read from standard out
-	ioBufferStdOut, err = cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	ioBufferStdErr, err = cmd.StderrPipe()
-	if err != nil {
-		return err
-	}
-
-	r.Log.Debugf("running Cmd0: %s ", cmd.String())
+	// Files, when set, get the raw output of the commands, by name
+	Files map[string]io.Writer
 
-	// Make a new channel which will be used to ensure we get all output
-	done := make(chan struct{})
+	// Executor starts the commands, os/exec when nil
+	Executor Executor
+}
 
-	// Create a scannerStdErr which scans r InputC a line-by-line fashion
-	scannerStdErr := bufio.NewScanner(ioBufferStdErr)
-	scannerStdErrBuf := make([]byte, 0, 5*1024*1024)
-	scannerStdErr.Buffer(scannerStdErrBuf, 5*1024*1024)
+// ErrKilled is the cause of the error returned by ExecContext when the
+// command did not stop within its grace period and was killed.
+var ErrKilled = errors.New("killed after the grace period")
 
-	scannerStdOut := bufio.NewScanner(ioBufferStdOut)
-	scannerStdOutBuf := make([]byte, 0, 5*1024*1024)
-	scannerStdOut.Buffer(scannerStdOutBuf, 5*1024*1024)
+// Stop is how ExecContext stops a command when its context is done: Signal
+// is sent and, when the command is still running after GracePeriod, it is
+// killed. The zero value sends SIGTERM and waits 10 seconds.
+type Stop struct {
+	Signal      os.Signal
+	GracePeriod time.Duration
+}
 
-	// Use the scannerStdErr to scan the output line by line and Log it
-	// It's running InputC a goroutine so that it doesn't block
-	go func() {
-		// Read line by line and process it
-		for scannerStdErr.Scan() {
-			newLine := scannerStdErr.Text() + "\n"
-			if strings.Contains(newLine, "Error") {
-				r.processError(newLine)
-			} else {
-				r.processInfo(newLine)
-			}
-		}
-		if scannerStdErr.Err() != nil {
-			r.Log.Error("STDERR: ", scannerStdErr.Err())
-		}
-		r.Log.Info("stderr processing finished")
-		done <- struct{}{}
-	}()
+func (r *P) Exec(name, cmdPath string, cmdArgs []string) (err error) {
+	return r.ExecContext(context.Background(), name, cmdPath, cmdArgs, Stop{})
+}
 
-	go func() {
-		// Read line by line and process it
-		for scannerStdOut.Scan() {
-			newLine := scannerStdOut.Text() + "\n"
-			if strings.Contains(newLine, "Error") {
-				r.processError(newLine)
-			} else {
-				r.processInfo(newLine)
-			}
-		}
-		if scannerStdOut.Err() != nil {
-			r.Log.Error("STDOUT: ", scannerStdOut.Err())
-		}
-		r.Log.Info("stdout processing finished")
-		done <- struct{}{}
-	}()
+func (r *P) executor() Executor {
+	if r.Executor == nil {
+		return OSExecutor{}
+	}
+	return r.Executor
+}
 
-	// StartCnode the command and check for errors
-	err = r.startCommand(cmd)
-	if err != nil {
-		err = errors.Annotatef(err, "startCommand failed for %s",
-			name)
+// ExecContext runs the command until it exits, the command is stopped as
+// set by stop when ctx is done.
+func (r *P) ExecContext(ctx context.Context, name, cmdPath string, cmdArgs []string, stop Stop) (err error) {
+	return r.ExecSpec(ctx, Spec{Name: name, Path: cmdPath, Args: cmdArgs}, stop)
+}
 
-		return err
+// ExecSpec runs spec like ExecContext.
+func (r *P) ExecSpec(ctx context.Context, spec Spec, stop Stop) (err error) {
+	name := spec.Name
+	if stop.Signal == nil {
+		stop.Signal = syscall.SIGTERM
+	}
+	if stop.GracePeriod == 0 {
+		stop.GracePeriod = time.Second * 10
 	}
-	// Wait for all output to be processed
 
-	<-done
-	r.Log.Info("all output processed, cmd: ", cmd.String())
-	// Wait for the command to finish
-	err = r.waitCommand(cmd)
+	r.Log.Infof("%s args: %s %v", name, spec.Path, spec.Args)
+	proc, err := r.executor().Start(spec)
 	if err != nil {
-		err = errors.Annotatef(err, "%s:",
-			name)
+		err = errors.Annotatef(err, "startCommand failed for %s", name)
 		r.Log.Error(err.Error())
+		time.Sleep(time.Millisecond * 500)
 		return err
 	}
+	r.Log.Debugf("running %s, pid %d", name, proc.Status().PID)
 
-	return err
-}
-
-//cardano.node.BlockFetchClient
-func (r *P) processError(line string) {
-	// Application Exception: 76.255.14.156:3005 ExceededTimeLimit
-	//fmt.Println(line)
-	if !strings.Contains(line, "Email cannot be sent") {
-		fmt.Println(line)
-	}
+	exited := make(chan struct{})
+	var killed int32
+	go func() {
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		r.Log.Infof("stopping %s with %v, grace period: %v", name, stop.Signal, stop.GracePeriod)
+		if er := proc.Signal(stop.Signal); er != nil {
+			r.Log.Warnf("signaling %s: %s", name, er.Error())
+		}
+		select {
+		case <-exited:
+		case <-time.After(stop.GracePeriod):
+			r.Log.Warnf("%s did not stop within %v, killing it", name, stop.GracePeriod)
+			atomic.StoreInt32(&killed, 1)
+			_ = proc.Signal(os.Kill)
+		}
+	}()
 
-	timeRe := regexp.MustCompile(`Application Exception: (\d+\.+\d+\.+\d+\.+\d+:\d+) ExceededTimeLimit`)
-	if timeRe.Match([]byte(line)) {
-		l := timeRe.FindStringSubmatch(line)
-		r.Log.Errorf("time limit error: %s", l[1])
+	// Wait for all output to be processed
+	for line := range proc.Output() {
+		r.processLine(name, line)
 	}
-	//cardano_relay1.1.7ok8rxpj2x8d@raspberry00    | [34e768bb:cardano.node.DnsSubscription:Error:17976] [2021-05-10 18:57:35.21 UTC] Domain: "rocinante.mooo.com" Connection Attempt Exception, destination 186.32.161.134:5100 exception: Network.Socket.connect: <socket: 48>: does not exist (Connection refused)
-}
-func (r *P) processInfo(line string) {
-	if !strings.Contains(line, "cardano.node.BlockFetchClient") &&
-		!strings.Contains(line, "cardano.node.BlockFetchDecision") {
-		fmt.Println(line)
+	r.Log.Info("all output processed: ", name)
+	// Wait for the command to finish
+	err = proc.Wait()
+	close(exited)
+	if atomic.LoadInt32(&killed) == 1 {
+		return errors.Annotatef(ErrKilled, "%s", name)
 	}
-}
-
-func (r *P) startCommand(cmd *exec.Cmd) error {
-	lcCmd := cmd.String()
-	err := cmd.Start()
 	if err != nil {
-		err = errors.Annotatef(err, "while attempting to start command %s",
-			lcCmd)
+		err = errors.Annotatef(err, "%s:", name)
 		r.Log.Error(err.Error())
 		time.Sleep(time.Millisecond * 500)
 		return err
@@ -145,14 +123,20 @@ func (r *P) startCommand(cmd *exec.Cmd) error {
 	return nil
 }
 
-func (r *P) waitCommand(cmd *exec.Cmd) error {
-	lcCmd := cmd.String()
-	err := cmd.Wait()
-	if err != nil {
-		err = errors.Annotatef(err, "waitCommand failed for %s",
-			lcCmd)
-		time.Sleep(time.Millisecond * 500)
-		return err
+// processLine writes line to the output file of service, publishes the
+// event parsed from it and routes it following the log rules of service.
+func (r *P) processLine(service, line string) {
+	if w := r.Files[service]; w != nil {
+		if _, err := io.WriteString(w, line); err != nil {
+			r.Log.Errorf("writing %s output: %s", service, err.Error())
+		}
+	}
+	var e *nodelog.Event
+	if ev, err := nodelog.Parse(line); err == nil {
+		e = &ev
+		r.Events.Publish(ev)
+	}
+	if _, err := r.Router.Route(service, line, e); err != nil {
+		r.Log.Errorf("routing %s output: %s", service, err.Error())
 	}
-	return nil
 }
@@ -0,0 +1,195 @@
+package process_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/nodelog"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+func TestExecContext(t *testing.T) {
+	a := assert.New(t)
+	p := process.P{Log: zap.NewNop().Sugar()}
+
+	// sleep exits on SIGINT
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	err := p.ExecContext(ctx, "sleep", "sleep", []string{"10"},
+		process.Stop{Signal: syscall.SIGINT, GracePeriod: time.Second * 5})
+	a.NotNil(err)
+	a.NotEqual(process.ErrKilled, errors.Cause(err))
+	a.Less(int64(time.Since(start)), int64(time.Second*5))
+
+	// sleep ignores SIGTERM, it is killed after the grace period
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start = time.Now()
+	err = p.ExecContext(ctx, "sleep", "sh", []string{"-c", `trap "" TERM; exec sleep 10`},
+		process.Stop{GracePeriod: time.Millisecond * 200})
+	a.Equal(process.ErrKilled, errors.Cause(err))
+	a.Less(int64(time.Since(start)), int64(time.Second*5))
+}
+
+func TestExecEvents(t *testing.T) {
+	a := assert.New(t)
+	const line = `[34e768bb:cardano.node.DnsSubscription:Error:17976] [2021-05-10 18:57:35.21 UTC] Domain: "rocinante.mooo.com" Connection Attempt Exception, destination 186.32.161.134:5100 exception: Network.Socket.connect: <socket: 48>: does not exist (Connection refused)`
+
+	p := process.P{
+		Log:    zap.NewNop().Sugar(),
+		Events: nodelog.NewBus(),
+	}
+	events := make(chan nodelog.Event, 1)
+	p.Events.Subscribe(func(e nodelog.Event) { events <- e })
+
+	err := p.ExecContext(context.Background(), "echo", "sh", []string{"-c", fmt.Sprintf("echo '%s' >&2", line)}, process.Stop{})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	e := <-events
+	a.Equal("cardano.node.DnsSubscription", e.Namespace)
+	a.Equal(nodelog.Error, e.Severity)
+	a.Equal(line, e.Raw)
+}
+
+func TestExecFiles(t *testing.T) {
+	a := assert.New(t)
+	router, err := process.NewRouter(map[string][]config.LogRule{"echo": {{Action: config.LogDrop}}})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	file := &bytes.Buffer{}
+	p := process.P{
+		Log:    zap.NewNop().Sugar(),
+		Router: router,
+		Files:  map[string]io.Writer{"echo": file},
+	}
+
+	// the files get the raw output, whatever the log rules
+	err = p.ExecContext(context.Background(), "echo", "echo", []string{"dropped from the console"}, process.Stop{})
+	a.Nil(err)
+	a.Equal("dropped from the console\n", file.String())
+	a.Equal(uint64(1), router.Counts()["echo[0]"])
+}
+
+func TestOSExecutor(t *testing.T) {
+	a := assert.New(t)
+	proc, err := process.OSExecutor{}.Start(process.Spec{Name: "sh", Path: "sh", Args: []string{"-c", "echo out; echo err >&2; exit 3"}})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.True(proc.Status().Running)
+	a.NotZero(proc.Status().PID)
+
+	lines := make([]string, 0)
+	for line := range proc.Output() {
+		lines = append(lines, line)
+	}
+	a.ElementsMatch([]string{"out\n", "err\n"}, lines)
+	a.NotNil(proc.Wait())
+	a.Equal(proc.Wait(), proc.Wait())
+	a.False(proc.Status().Running)
+	a.Equal(3, proc.Status().ExitCode)
+
+	_, err = process.OSExecutor{}.Start(process.Spec{Name: "missing", Path: "/nonexistent/missing"})
+	a.NotNil(err)
+}
+
+func TestExecFake(t *testing.T) {
+	a := assert.New(t)
+	out := &bytes.Buffer{}
+	router, err := process.NewRouter(nil)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	router.Out = out
+	fake := process.NewFakeExecutor()
+	p := process.P{Log: zap.NewNop().Sugar(), Router: router, Executor: fake}
+
+	// the process exits on the stop signal
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.ExecContext(ctx, "cardano-node", "cardano-node", []string{"run"},
+			process.Stop{Signal: syscall.SIGINT, GracePeriod: time.Second})
+	}()
+	proc := <-fake.Started()
+	a.Equal(process.Spec{Name: "cardano-node", Path: "cardano-node", Args: []string{"run"}}, proc.Spec)
+	proc.Write("chain extended\n")
+	cancel()
+	err = <-done
+	a.NotNil(err)
+	a.NotEqual(process.ErrKilled, errors.Cause(err))
+	a.Equal("chain extended\n", out.String())
+	a.Equal([]os.Signal{syscall.SIGINT}, proc.Signals())
+	a.False(proc.Status().Running)
+
+	// the process ignores the stop signal and is killed
+	fake.IgnoreSignals = true
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		done <- p.ExecContext(ctx, "cardano-node", "cardano-node", nil,
+			process.Stop{Signal: syscall.SIGINT, GracePeriod: time.Millisecond * 50})
+	}()
+	proc = <-fake.Started()
+	cancel()
+	a.Equal(process.ErrKilled, errors.Cause(<-done))
+	a.Equal([]os.Signal{syscall.SIGINT, os.Kill}, proc.Signals())
+
+	// the process exits by itself
+	go func() {
+		done <- p.ExecContext(context.Background(), "cardano-node", "cardano-node", nil, process.Stop{})
+	}()
+	proc = <-fake.Started()
+	proc.Exit(nil)
+	a.Nil(<-done)
+	a.Len(fake.Processes(), 3)
+
+	fake.StartErr = errors.New("no such file")
+	a.NotNil(p.ExecContext(context.Background(), "cardano-node", "cardano-node", nil, process.Stop{}))
+}
+
+func TestFakeProcessWriteAfterExit(t *testing.T) {
+	a := assert.New(t)
+	fake := process.NewFakeExecutor()
+	for i := 0; i < 100; i++ {
+		proc, err := fake.Start(process.Spec{Name: "node"})
+		if !a.Nil(err) {
+			t.FailNow()
+		}
+		p := <-fake.Started()
+		go func() {
+			for range proc.Output() {
+			}
+		}()
+
+		// writes racing with the exit are dropped, they never panic
+		done := make(chan struct{})
+		for w := 0; w < 4; w++ {
+			go func() {
+				for j := 0; j < 10; j++ {
+					p.Write("line\n")
+				}
+				done <- struct{}{}
+			}()
+		}
+		p.Exit(nil)
+		for w := 0; w < 4; w++ {
+			<-done
+		}
+		p.Write("after exit\n")
+		a.Nil(proc.Wait())
+	}
+}
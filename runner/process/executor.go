@@ -0,0 +1,161 @@
+package process
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Spec is a command to run.
+type Spec struct {
+	// Name identifies the command in logs and routing
+	Name string
+	Path string
+	Args []string
+	// Env are KEY=value variables added to the environment of gocnode
+	Env []string
+	// Dir is the working directory, the one of gocnode when empty
+	Dir string
+}
+
+// ProcessStatus is the state of a started process.
+type ProcessStatus struct {
+	PID       int       `json:"pid"`
+	Running   bool      `json:"running"`
+	StartedAt time.Time `json:"started_at"`
+	ExitedAt  time.Time `json:"exited_at"`
+	ExitCode  int       `json:"exit_code"`
+}
+
+// Process is a process started by an Executor.
+type Process interface {
+	// Output streams the lines written by the process to stdout and
+	// stderr, with their trailing newline. It is closed once the process
+	// closed both.
+	Output() <-chan string
+	// Signal sends sig to the process.
+	Signal(sig os.Signal) error
+	// Wait waits for the process to exit, Output must be drained first.
+	// Every call returns the same error.
+	Wait() error
+	// Status returns the state of the process.
+	Status() ProcessStatus
+}
+
+// Executor starts processes.
+type Executor interface {
+	Start(spec Spec) (Process, error)
+}
+
+// maxLine is the longest line the OSExecutor streams, cardano-node writes
+// long JSON lines
+const maxLine = 5 * 1024 * 1024
+
+// OSExecutor runs processes with os/exec.
+type OSExecutor struct{}
+
+// Start starts spec, its output is streamed from the start.
+func (OSExecutor) Start(spec Spec) (Process, error) {
+	cmd := exec.Command(spec.Path, spec.Args...)
+	if len(spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), spec.Env...)
+	}
+	cmd.Dir = spec.Dir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Annotatef(err, "while attempting to start command %s", cmd.String())
+	}
+
+	p := &osProcess{
+		cmd:    cmd,
+		out:    make(chan string),
+		status: ProcessStatus{PID: cmd.Process.Pid, Running: true, StartedAt: time.Now()},
+	}
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			p.stream(r)
+		}(r)
+	}
+	go func() {
+		wg.Wait()
+		close(p.out)
+	}()
+	return p, nil
+}
+
+type osProcess struct {
+	cmd  *exec.Cmd
+	out  chan string
+	once sync.Once
+	err  error
+
+	mu     sync.Mutex
+	status ProcessStatus
+	// streamErr is the first error reading the output
+	streamErr error
+}
+
+func (p *osProcess) stream(r io.Reader) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, maxLine), maxLine)
+	for s.Scan() {
+		p.out <- s.Text() + "\n"
+	}
+	if err := s.Err(); err != nil {
+		p.mu.Lock()
+		if p.streamErr == nil {
+			p.streamErr = err
+		}
+		p.mu.Unlock()
+		// drain the pipe so that the process does not block writing
+		_, _ = io.Copy(io.Discard, r)
+	}
+}
+
+func (p *osProcess) Output() <-chan string {
+	return p.out
+}
+
+func (p *osProcess) Signal(sig os.Signal) error {
+	return p.cmd.Process.Signal(sig)
+}
+
+func (p *osProcess) Wait() error {
+	p.once.Do(func() {
+		err := p.cmd.Wait()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.status.Running = false
+		p.status.ExitedAt = time.Now()
+		p.status.ExitCode = p.cmd.ProcessState.ExitCode()
+		if err == nil {
+			err = p.streamErr
+		}
+		if err != nil {
+			err = errors.Annotatef(err, "waitCommand failed for %s", p.cmd.String())
+		}
+		p.err = err
+	})
+	return p.err
+}
+
+func (p *osProcess) Status() ProcessStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
@@ -0,0 +1,173 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FakeExecutor is an in-memory Executor for tests, its processes run until
+// they are told to exit or are signaled.
+type FakeExecutor struct {
+	// StartErr, when set, is returned by Start
+	StartErr error
+	// IgnoreSignals keeps the processes running when signaled, unless the
+	// signal is os.Kill
+	IgnoreSignals bool
+
+	mu      sync.Mutex
+	procs   []*FakeProcess
+	started chan *FakeProcess
+}
+
+// NewFakeExecutor returns a fake executor.
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{started: make(chan *FakeProcess, 100)}
+}
+
+// Start starts a fake process running spec.
+func (f *FakeExecutor) Start(spec Spec) (Process, error) {
+	if f.StartErr != nil {
+		return nil, f.StartErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := &FakeProcess{
+		Spec:          spec,
+		ignoreSignals: f.IgnoreSignals,
+		out:           make(chan string),
+		exited:        make(chan struct{}),
+		status: ProcessStatus{
+			PID:       len(f.procs) + 1,
+			Running:   true,
+			StartedAt: time.Now(),
+		},
+	}
+	f.procs = append(f.procs, p)
+	select {
+	case f.started <- p:
+	default:
+	}
+	return p, nil
+}
+
+// Started returns the processes as they are started, it is nil when f was
+// not made by NewFakeExecutor.
+func (f *FakeExecutor) Started() <-chan *FakeProcess {
+	return f.started
+}
+
+// Processes returns the processes started so far.
+func (f *FakeExecutor) Processes() []*FakeProcess {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*FakeProcess(nil), f.procs...)
+}
+
+// FakeProcess is a process of a FakeExecutor.
+type FakeProcess struct {
+	Spec Spec
+
+	ignoreSignals bool
+	out           chan string
+	exited        chan struct{}
+
+	mu      sync.Mutex
+	err     error
+	signals []os.Signal
+	status  ProcessStatus
+	// done is set once the process exited, out is closed once it is set
+	// and no Write is sending
+	done    bool
+	writers int
+}
+
+// Write makes the process write line, it blocks until the line is read from
+// Output and is dropped once the process exited.
+func (p *FakeProcess) Write(line string) {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return
+	}
+	p.writers++
+	p.mu.Unlock()
+
+	select {
+	case p.out <- line:
+	case <-p.exited:
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writers--
+	if p.done && p.writers == 0 {
+		close(p.out)
+	}
+}
+
+// Exit makes the process exit with err, its exit code is 1 when err is not
+// nil. Only the first call has an effect.
+func (p *FakeProcess) Exit(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	p.err = err
+	p.status.Running = false
+	p.status.ExitedAt = time.Now()
+	if err != nil {
+		p.status.ExitCode = 1
+	}
+	close(p.exited)
+	if p.writers == 0 {
+		close(p.out)
+	}
+}
+
+// Exited is closed when the process exits.
+func (p *FakeProcess) Exited() <-chan struct{} {
+	return p.exited
+}
+
+// Signals returns the signals sent to the process.
+func (p *FakeProcess) Signals() []os.Signal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]os.Signal(nil), p.signals...)
+}
+
+func (p *FakeProcess) Output() <-chan string {
+	return p.out
+}
+
+func (p *FakeProcess) Signal(sig os.Signal) error {
+	p.mu.Lock()
+	p.signals = append(p.signals, sig)
+	p.mu.Unlock()
+	select {
+	case <-p.exited:
+		return os.ErrProcessDone
+	default:
+	}
+	if !p.ignoreSignals || sig == os.Kill {
+		p.Exit(fmt.Errorf("signal: %v", sig))
+	}
+	return nil
+}
+
+func (p *FakeProcess) Wait() error {
+	<-p.exited
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *FakeProcess) Status() ProcessStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// readyTimeout bounds a single readiness check
+const readyTimeout = time.Second * 2
+
+// ReadyFile is ready once path exists, such as the socket of cardano-node.
+func ReadyFile(path string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := os.Stat(path)
+		return err
+	}
+}
+
+// ReadyTCP is ready once addr, host:port, accepts connections.
+func ReadyTCP(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		d := net.Dialer{Timeout: readyTimeout}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// ReadyHTTP is ready once url answers a GET with a 2xx status.
+func ReadyHTTP(url string) func(ctx context.Context) error {
+	client := &http.Client{Timeout: readyTimeout}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("%s: %s", url, resp.Status)
+		}
+		return nil
+	}
+}
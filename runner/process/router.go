@@ -0,0 +1,179 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/adakailabs/gocnode/config"
+	l "github.com/adakailabs/gocnode/logger"
+	"github.com/adakailabs/gocnode/nodelog"
+)
+
+// rule is a compiled config.LogRule
+type rule struct {
+	config.LogRule
+	min, max nodelog.Severity
+	match    *regexp.Regexp
+}
+
+func (ru *rule) matches(line string, e *nodelog.Event) bool {
+	if ru.Namespace != "" || ru.MinSeverity != "" || ru.MaxSeverity != "" {
+		if e == nil {
+			return false
+		}
+		if ru.Namespace != "" && e.Namespace != ru.Namespace && !strings.HasPrefix(e.Namespace, ru.Namespace+".") {
+			return false
+		}
+		if e.Severity < ru.min || e.Severity > ru.max {
+			return false
+		}
+	}
+	return ru.match == nil || ru.match.MatchString(line)
+}
+
+// Router applies the log rules of the services to the lines they write.
+// The rules can be replaced while the services run. A nil Router prints
+// every line.
+type Router struct {
+	mu     sync.Mutex
+	rules  map[string][]rule
+	counts map[string]uint64
+	files  map[string]io.WriteCloser
+	// Out is where the print action writes, os.Stdout by default
+	Out io.Writer
+}
+
+// NewRouter returns a router applying rules, keyed by service name.
+func NewRouter(rules map[string][]config.LogRule) (*Router, error) {
+	r := &Router{
+		counts: make(map[string]uint64),
+		files:  make(map[string]io.WriteCloser),
+		Out:    os.Stdout,
+	}
+	if err := r.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetRules replaces the rules of the router, the files of the previous
+// rules are closed. The counters are kept.
+func (r *Router) SetRules(rules map[string][]config.LogRule) error {
+	compiled := make(map[string][]rule, len(rules))
+	for service, rs := range rules {
+		for i, lr := range rs {
+			if lr.Name == "" {
+				lr.Name = fmt.Sprintf("%s[%d]", service, i)
+			}
+			ru := rule{LogRule: lr, min: nodelog.Debug, max: nodelog.Emergency}
+			var err error
+			if lr.MinSeverity != "" {
+				if ru.min, err = nodelog.ParseSeverity(lr.MinSeverity); err != nil {
+					return errors.Annotatef(err, "log rule %s", lr.Name)
+				}
+			}
+			if lr.MaxSeverity != "" {
+				if ru.max, err = nodelog.ParseSeverity(lr.MaxSeverity); err != nil {
+					return errors.Annotatef(err, "log rule %s", lr.Name)
+				}
+			}
+			if lr.Match != "" {
+				if ru.match, err = regexp.Compile(lr.Match); err != nil {
+					return errors.Annotatef(err, "log rule %s", lr.Name)
+				}
+			}
+			compiled[service] = append(compiled[service], ru)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = compiled
+	r.closeFiles()
+	return nil
+}
+
+// Route applies the first rule of service matching line, e is the event
+// parsed from line, nil when line is not in cardano-node's log format. It
+// returns the applied action.
+func (r *Router) Route(service, line string, e *nodelog.Event) (action string, err error) {
+	if r == nil {
+		fmt.Print(line)
+		return config.LogPrint, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.rules[service] {
+		ru := &r.rules[service][i]
+		if !ru.matches(line, e) {
+			continue
+		}
+		r.counts[ru.Name]++
+		switch ru.Action {
+		case config.LogPrint:
+			_, err = io.WriteString(r.Out, line)
+		case config.LogFile:
+			err = r.write(ru.File, line)
+		}
+		return ru.Action, err
+	}
+	_, err = io.WriteString(r.Out, line)
+	return config.LogPrint, err
+}
+
+// ruleFileRotation is how the files of the file action are rotated
+var ruleFileRotation = l.RotateConfig{MaxSize: 100 * 1024 * 1024, MaxBackups: 7, Compress: true}
+
+func (r *Router) write(file, line string) error {
+	w, ok := r.files[file]
+	if !ok {
+		c := ruleFileRotation
+		c.Path = file
+		rot, err := l.NewRotator(c)
+		if err != nil {
+			return err
+		}
+		w = rot
+		r.files[file] = w
+	}
+	_, err := io.WriteString(w, line)
+	return err
+}
+
+// Counts returns how many lines matched each rule, by rule name.
+func (r *Router) Counts() map[string]uint64 {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]uint64, len(r.counts))
+	for k, v := range r.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Close closes the files the router writes to.
+func (r *Router) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeFiles()
+}
+
+func (r *Router) closeFiles() {
+	for name, f := range r.files {
+		_ = f.Close()
+		delete(r.files, name)
+	}
+}
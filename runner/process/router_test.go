@@ -0,0 +1,93 @@
+package process_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/nodelog"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+const (
+	blockFetchLine = "[34e768bb:cardano.node.BlockFetchClient:Info:61] [2021-05-10 18:57:36.02 UTC] [TraceLabelPeer (ConnectionId {localAddress = 172.17.0.2:3001, remoteAddress = 3.125.94.58:3001}) (CompletedBlockFetch (At (Block {blockPointSlot = SlotNo 28857120})))]\n"
+	dnsErrorLine   = `[34e768bb:cardano.node.DnsSubscription:Error:17976] [2021-05-10 18:57:35.21 UTC] Domain: "rocinante.mooo.com" Connection Attempt Exception, destination 186.32.161.134:5100 exception: Network.Socket.connect: <socket: 48>: does not exist (Connection refused)` + "\n"
+	chainDBLine    = "[34e768bb:cardano.node.ChainDB:Notice:47] [2021-05-10 18:57:36.02 UTC] Chain extended, new tip: 6df8fe7bb3e6f2b7f0db2b4dd3e0b4a3f36b5b8a5c43ad0e3e6a1ab5d96b5c1d at slot 28857120\n"
+	emailLine      = "Email cannot be sent: no SMTP server configured, Error\n"
+)
+
+func route(a *assert.Assertions, r *process.Router, service, line string) string {
+	var e *nodelog.Event
+	if ev, err := nodelog.Parse(line); err == nil {
+		e = &ev
+	}
+	action, err := r.Route(service, line, e)
+	a.Nil(err)
+	return action
+}
+
+func TestRouterDefaultRules(t *testing.T) {
+	a := assert.New(t)
+	r, err := process.NewRouter(config.DefaultLogRules)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	out := &bytes.Buffer{}
+	r.Out = out
+
+	a.Equal(config.LogDrop, route(a, r, "cardano-node", blockFetchLine))
+	a.Equal(config.LogDrop, route(a, r, "cardano-node", emailLine))
+	a.Equal(config.LogPrint, route(a, r, "cardano-node", dnsErrorLine))
+	// the rules are per service
+	a.Equal(config.LogPrint, route(a, r, "node_exporter", blockFetchLine))
+
+	a.Equal(dnsErrorLine+blockFetchLine, out.String())
+	a.Equal(map[string]uint64{"block_fetch_client": 1, "email": 1}, r.Counts())
+}
+
+func TestRouterRules(t *testing.T) {
+	a := assert.New(t)
+	file := filepath.Join(t.TempDir(), "logs", "errors.log")
+	r, err := process.NewRouter(map[string][]config.LogRule{
+		"cardano-node": {
+			{Name: "errors", MinSeverity: "Warning", Action: config.LogFile, File: file},
+			{Name: "tips", Namespace: "cardano.node", MaxSeverity: "Notice", Match: `new tip`, Action: config.LogCount},
+			{Name: "rest", Action: config.LogDrop},
+		},
+	})
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	out := &bytes.Buffer{}
+	r.Out = out
+
+	a.Equal(config.LogFile, route(a, r, "cardano-node", dnsErrorLine))
+	a.Equal(config.LogCount, route(a, r, "cardano-node", chainDBLine))
+	a.Equal(config.LogDrop, route(a, r, "cardano-node", blockFetchLine))
+	// namespace and severity rules never match lines that do not parse
+	a.Equal(config.LogDrop, route(a, r, "cardano-node", emailLine))
+	a.Equal("", out.String())
+	a.Equal(map[string]uint64{"errors": 1, "tips": 1, "rest": 2}, r.Counts())
+
+	// new rules replace the old ones, the counters are kept
+	a.Nil(r.SetRules(map[string][]config.LogRule{
+		"cardano-node": {{Name: "errors", Match: "Error", Action: config.LogFile, File: file}},
+	}))
+	a.Equal(config.LogFile, route(a, r, "cardano-node", emailLine))
+	a.Equal(config.LogPrint, route(a, r, "cardano-node", chainDBLine))
+	r.Close()
+
+	b, err := ioutil.ReadFile(file)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Equal(dnsErrorLine+emailLine, string(b))
+	a.Equal(chainDBLine, out.String())
+	a.Equal(uint64(2), r.Counts()["errors"])
+
+	a.NotNil(r.SetRules(map[string][]config.LogRule{"cardano-node": {{Match: "("}}}))
+}
@@ -0,0 +1,469 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+)
+
+// Restart policies of a supervised service
+const (
+	// RestartAlways restarts the service whenever it exits
+	RestartAlways = config.RestartAlways
+	// RestartOnFailure restarts the service when it exits with an error
+	RestartOnFailure = config.RestartOnFailure
+	// RestartNever lets the service stop for good
+	RestartNever = config.RestartNever
+)
+
+// States of a supervised service
+const (
+	StateRunning   = "running"
+	StateBackoff   = "backoff"
+	StateStopped   = "stopped"
+	StateFailed    = "failed"
+	StateCrashLoop = "crash-loop"
+)
+
+// Service is a child process, or any long running task, run by a
+// Supervisor.
+type Service struct {
+	Name string
+	// Policy is the default restart policy, the supervisor configuration
+	// can override it
+	Policy string
+	// Deps are the services this one needs, it is started once they are
+	// ready, see Ready, and stopped before them. When one of them stops for
+	// good before it is ready this one fails without being started.
+	Deps []string
+	// StopBefore are services this one is stopped before, its start does
+	// not wait for them
+	StopBefore []string
+	// Run runs the service until it exits or ctx is done
+	Run func(ctx context.Context) error
+	// Ready, when set, reports whether the service is ready, the services
+	// depending on it are started once it returns nil. A service without
+	// it is ready once started.
+	Ready func(ctx context.Context) error
+}
+
+// ServiceStatus is the state of a supervised service.
+type ServiceStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Policy    string    `json:"policy"`
+	Restarts  int       `json:"restarts"`
+	Ready     bool      `json:"ready"`
+	StartedAt time.Time `json:"started_at"`
+	LastExit  time.Time `json:"last_exit,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Supervisor runs services and restarts them following their restart
+// policy, waiting an exponential backoff between restarts. A service that
+// fails max_restarts times within window is in a crash loop: the
+// supervisor gives up on it and stops every other service.
+type Supervisor struct {
+	log      *zap.SugaredLogger
+	conf     config.Supervisor
+	services []Service
+
+	// stopping is closed when the supervisor shuts down, services that exit
+	// after that are not restarted
+	stopping chan struct{}
+
+	mu     sync.Mutex
+	status map[string]*ServiceStatus
+	killed []string
+	// cancels stop the running services, restarts are the services
+	// stopped by Restart
+	cancels  map[string]context.CancelFunc
+	restarts map[string]bool
+}
+
+func NewSupervisor(log *zap.SugaredLogger, conf config.Supervisor) *Supervisor {
+	return &Supervisor{
+		log:      log,
+		conf:     conf,
+		status:   make(map[string]*ServiceStatus),
+		stopping: make(chan struct{}),
+		cancels:  make(map[string]context.CancelFunc),
+		restarts: make(map[string]bool),
+	}
+}
+
+// Add registers a service, it is started by Run.
+func (s *Supervisor) Add(svc Service) {
+	if p, ok := s.conf.Policies[svc.Name]; ok {
+		svc.Policy = p
+	}
+	if svc.Policy == "" {
+		svc.Policy = RestartOnFailure
+	}
+	s.services = append(s.services, svc)
+
+	s.mu.Lock()
+	s.status[svc.Name] = &ServiceStatus{Name: svc.Name, State: StateStopped, Policy: svc.Policy}
+	s.mu.Unlock()
+}
+
+// Status returns the state of every service, sorted by name.
+func (s *Supervisor) Status() []ServiceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := make([]ServiceStatus, 0, len(s.status))
+	for _, v := range s.status {
+		st = append(st, *v)
+	}
+	sort.Slice(st, func(i, j int) bool { return st[i].Name < st[j].Name })
+	return st
+}
+
+// Restart stops the running service name, it is started again right away
+// whatever its policy and without counting as a failure.
+func (s *Supervisor) Restart(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.cancels[name]
+	if !ok {
+		return fmt.Errorf("service %s is not running", name)
+	}
+	s.restarts[name] = true
+	cancel()
+	return nil
+}
+
+func (s *Supervisor) isStopping() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Supervisor) update(name string, f func(st *ServiceStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.status[name])
+}
+
+// levels returns the services grouped by dependency level: the services of
+// a level only depend on, or are stopped before, services of the previous
+// levels.
+func (s *Supervisor) levels() ([][]Service, error) {
+	byName := make(map[string]Service, len(s.services))
+	for _, svc := range s.services {
+		byName[svc.Name] = svc
+	}
+
+	level := make(map[string]int, len(s.services))
+	var visit func(name string, path []string) (int, error)
+	visit = func(name string, path []string) (int, error) {
+		if l, ok := level[name]; ok {
+			if l < 0 {
+				return 0, fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+			}
+			return l, nil
+		}
+		level[name] = -1
+		l := 0
+		svc := byName[name]
+		for _, dep := range append(append([]string{}, svc.Deps...), svc.StopBefore...) {
+			if _, ok := byName[dep]; !ok {
+				return 0, fmt.Errorf("service %s depends on unknown service %s", name, dep)
+			}
+			dl, err := visit(dep, append(path, name))
+			if err != nil {
+				return 0, err
+			}
+			if dl+1 > l {
+				l = dl + 1
+			}
+		}
+		level[name] = l
+		return l, nil
+	}
+
+	levels := make([][]Service, 0)
+	for _, svc := range s.services {
+		l, err := visit(svc.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+	}
+	for _, svc := range s.services {
+		levels[level[svc.Name]] = append(levels[level[svc.Name]], svc)
+	}
+	return levels, nil
+}
+
+// Run starts every service, once the services it depends on are ready, and
+// supervises them until ctx is done, every service stopped for good or one
+// of them is in a crash loop. Then the remaining services are stopped,
+// the services that depend on others first. Run returns the crash loop
+// error or, when a service had to be killed because it did not stop within
+// its grace period, an error caused by ErrKilled.
+func (s *Supervisor) Run(ctx context.Context) error {
+	levels, err := s.levels()
+	if err != nil {
+		return err
+	}
+
+	type running struct {
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+	runs := make([][]running, len(levels))
+	failed := make(chan error, len(s.services))
+	// ready is closed when a service is ready, stopped when it stopped for
+	// good
+	ready := make(map[string]chan struct{}, len(s.services))
+	stopped := make(map[string]chan struct{}, len(s.services))
+	for _, svc := range s.services {
+		ready[svc.Name] = make(chan struct{})
+		stopped[svc.Name] = make(chan struct{})
+	}
+	all := sync.WaitGroup{}
+	for l, services := range levels {
+		for i := range services {
+			svcCtx, cancel := context.WithCancel(context.Background())
+			r := running{cancel: cancel, done: make(chan struct{})}
+			runs[l] = append(runs[l], r)
+			all.Add(1)
+			go func(svc Service) {
+				defer all.Done()
+				defer close(r.done)
+				defer close(stopped[svc.Name])
+				if er := s.waitDeps(svcCtx, svc, ready, stopped); er != nil {
+					if svcCtx.Err() == nil {
+						s.log.Errorf("service %s not started: %s", svc.Name, er.Error())
+						s.update(svc.Name, func(st *ServiceStatus) {
+							st.State = StateFailed
+							st.LastError = er.Error()
+						})
+					}
+					return
+				}
+				go s.watchReady(svcCtx, svc, ready[svc.Name])
+				if er := s.supervise(svcCtx, svc); er != nil {
+					failed <- er
+				}
+			}(services[i])
+		}
+	}
+	finished := make(chan struct{})
+	go func() {
+		all.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Info("shutting down services")
+	case err = <-failed:
+		s.log.Errorf("shutting down services: %s", err.Error())
+	case <-finished:
+	}
+	close(s.stopping)
+
+	for l := len(runs) - 1; l >= 0; l-- {
+		for _, r := range runs[l] {
+			r.cancel()
+		}
+		for _, r := range runs[l] {
+			<-r.done
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-failed:
+		return err
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.killed) > 0 {
+		return errors.Annotatef(ErrKilled, "%s", strings.Join(s.killed, ", "))
+	}
+	return nil
+}
+
+// waitDeps waits for the dependencies of svc to be ready. It returns an
+// error when ctx is done first or a dependency stopped for good before it
+// was ready.
+func (s *Supervisor) waitDeps(ctx context.Context, svc Service, ready, stopped map[string]chan struct{}) error {
+	for _, dep := range svc.Deps {
+		select {
+		case <-ready[dep]:
+			continue
+		default:
+		}
+		s.log.Infof("service %s waits for %s to be ready", svc.Name, dep)
+		select {
+		case <-ready[dep]:
+		case <-stopped[dep]:
+			select {
+			case <-ready[dep]:
+			default:
+				return fmt.Errorf("dependency %s stopped before it was ready", dep)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// watchReady runs the readiness check of svc until it passes, then closes
+// ready.
+func (s *Supervisor) watchReady(ctx context.Context, svc Service, ready chan struct{}) {
+	if svc.Ready != nil {
+		interval := s.conf.ReadyInterval
+		if interval == 0 {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := svc.Ready(ctx)
+			if err == nil {
+				break
+			}
+			s.log.Debugf("service %s not ready: %s", svc.Name, err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		s.log.Infof("service %s is ready", svc.Name)
+	}
+	s.update(svc.Name, func(st *ServiceStatus) { st.Ready = true })
+	close(ready)
+}
+
+// supervise runs svc until its policy says to stop, it returns an error
+// when svc is in a crash loop.
+func (s *Supervisor) supervise(ctx context.Context, svc Service) error {
+	failures := make([]time.Time, 0)
+	backoff := s.conf.InitialBackoff
+
+	for {
+		start := time.Now()
+		s.update(svc.Name, func(st *ServiceStatus) {
+			st.State = StateRunning
+			st.StartedAt = start
+		})
+		s.log.Infof("service %s started", svc.Name)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.cancels[svc.Name] = cancel
+		s.mu.Unlock()
+
+		err := svc.Run(runCtx)
+		cancel()
+		exited := time.Now()
+		s.mu.Lock()
+		delete(s.cancels, svc.Name)
+		restart := s.restarts[svc.Name]
+		delete(s.restarts, svc.Name)
+		s.mu.Unlock()
+		s.update(svc.Name, func(st *ServiceStatus) {
+			st.LastExit = exited
+			st.LastError = ""
+			if err != nil {
+				st.LastError = err.Error()
+			}
+		})
+
+		if ctx.Err() != nil || s.isStopping() {
+			if errors.Cause(err) == ErrKilled {
+				s.mu.Lock()
+				s.killed = append(s.killed, svc.Name)
+				s.mu.Unlock()
+			}
+			s.update(svc.Name, func(st *ServiceStatus) { st.State = StateStopped })
+			s.log.Infof("service %s stopped", svc.Name)
+			return nil
+		}
+
+		if restart {
+			s.update(svc.Name, func(st *ServiceStatus) { st.Restarts++ })
+			s.log.Warnf("service %s restarted on request", svc.Name)
+			continue
+		}
+
+		if err == nil {
+			s.log.Infof("service %s exited", svc.Name)
+		} else {
+			s.log.Errorf("service %s failed: %s", svc.Name, err.Error())
+		}
+
+		if svc.Policy == RestartNever || (svc.Policy == RestartOnFailure && err == nil) {
+			state := StateStopped
+			if err != nil {
+				state = StateFailed
+			}
+			s.update(svc.Name, func(st *ServiceStatus) { st.State = state })
+			return nil
+		}
+
+		// a service that ran longer than the window is healthy again
+		if exited.Sub(start) > s.conf.Window {
+			failures = failures[:0]
+			backoff = s.conf.InitialBackoff
+		}
+		if err != nil {
+			failures = append(failures, exited)
+			for len(failures) > 0 && exited.Sub(failures[0]) > s.conf.Window {
+				failures = failures[1:]
+			}
+			if uint(len(failures)) >= s.conf.MaxRestarts {
+				s.update(svc.Name, func(st *ServiceStatus) { st.State = StateCrashLoop })
+				return fmt.Errorf("service %s is crash looping: %d failures in %v, last: %s",
+					svc.Name, len(failures), s.conf.Window, err.Error())
+			}
+		}
+
+		var restarts int
+		s.update(svc.Name, func(st *ServiceStatus) {
+			st.State = StateBackoff
+			st.Restarts++
+			restarts = st.Restarts
+		})
+		s.log.Warnf("restarting service %s in %v (restart %d, %d recent failures)",
+			svc.Name, backoff, restarts, len(failures))
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stopping:
+			s.update(svc.Name, func(st *ServiceStatus) { st.State = StateStopped })
+			return nil
+		case <-ctx.Done():
+			s.update(svc.Name, func(st *ServiceStatus) { st.State = StateStopped })
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > s.conf.MaxBackoff {
+			backoff = s.conf.MaxBackoff
+		}
+	}
+}
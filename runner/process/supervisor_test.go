@@ -0,0 +1,347 @@
+package process_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/runner/process"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+func testSupervisor(policies map[string]string) *process.Supervisor {
+	return process.NewSupervisor(zap.NewNop().Sugar(), config.Supervisor{
+		Policies:       policies,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond * 4,
+		MaxRestarts:    3,
+		Window:         time.Minute,
+		ReadyInterval:  time.Millisecond,
+	})
+}
+
+func statusOf(s *process.Supervisor, name string) process.ServiceStatus {
+	for _, st := range s.Status() {
+		if st.Name == name {
+			return st
+		}
+	}
+	return process.ServiceStatus{}
+}
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	var runs int32
+	s.Add(process.Service{Name: "failing", Policy: process.RestartAlways, Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("exit status 1")
+	}})
+	stopped := make(chan struct{})
+	s.Add(process.Service{Name: "healthy", Policy: process.RestartAlways, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	}})
+
+	err := s.Run(context.Background())
+	if !a.NotNil(err) {
+		t.FailNow()
+	}
+	a.Contains(err.Error(), "crash looping")
+	a.Equal(int32(3), atomic.LoadInt32(&runs))
+
+	<-stopped
+	failing := statusOf(s, "failing")
+	a.Equal(process.StateCrashLoop, failing.State)
+	a.Equal(2, failing.Restarts)
+	a.Equal("exit status 1", failing.LastError)
+	a.Equal(process.StateStopped, statusOf(s, "healthy").State)
+}
+
+func TestSupervisorPolicies(t *testing.T) {
+	a := assert.New(t)
+	// the configuration overrides the service's policy
+	s := testSupervisor(map[string]string{"overridden": process.RestartNever})
+
+	var onFailureRuns, alwaysRuns, overriddenRuns int32
+	s.Add(process.Service{Name: "on-failure", Policy: process.RestartOnFailure, Run: func(ctx context.Context) error {
+		if atomic.AddInt32(&onFailureRuns, 1) == 1 {
+			return errors.New("first run fails")
+		}
+		return nil
+	}})
+	s.Add(process.Service{Name: "always", Policy: process.RestartAlways, Run: func(ctx context.Context) error {
+		if atomic.AddInt32(&alwaysRuns, 1) == 3 {
+			<-ctx.Done()
+		}
+		return nil
+	}})
+	s.Add(process.Service{Name: "overridden", Policy: process.RestartAlways, Run: func(ctx context.Context) error {
+		atomic.AddInt32(&overriddenRuns, 1)
+		return errors.New("fails once")
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	for atomic.LoadInt32(&alwaysRuns) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if !a.Nil(<-done) {
+		t.FailNow()
+	}
+
+	a.Equal(int32(2), atomic.LoadInt32(&onFailureRuns))
+	a.Equal(process.StateStopped, statusOf(s, "on-failure").State)
+	a.Equal(1, statusOf(s, "on-failure").Restarts)
+
+	a.Equal(int32(3), atomic.LoadInt32(&alwaysRuns))
+	a.Equal(2, statusOf(s, "always").Restarts)
+
+	a.Equal(int32(1), atomic.LoadInt32(&overriddenRuns))
+	a.Equal(process.RestartNever, statusOf(s, "overridden").Policy)
+	a.Equal(process.StateFailed, statusOf(s, "overridden").State)
+}
+
+func TestSupervisorAllStopped(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+	s.Add(process.Service{Name: "oneshot", Policy: process.RestartOnFailure, Run: func(ctx context.Context) error {
+		return nil
+	}})
+	a.Nil(s.Run(context.Background()))
+	a.Equal(process.StateStopped, statusOf(s, "oneshot").State)
+}
+
+func TestSupervisorShutdownOrder(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	stopped := make(chan string, 3)
+	run := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped <- name
+			return nil
+		}
+	}
+	s.Add(process.Service{Name: "sidecar", Deps: []string{"node"}, Run: run("sidecar")})
+	s.Add(process.Service{Name: "node", Policy: process.RestartAlways, Run: run("node")})
+	s.Add(process.Service{Name: "watcher", Deps: []string{"sidecar"}, Run: run("watcher")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	if !a.Nil(s.Run(ctx)) {
+		t.FailNow()
+	}
+	a.Equal("watcher", <-stopped)
+	a.Equal("sidecar", <-stopped)
+	a.Equal("node", <-stopped)
+}
+
+func TestSupervisorDependencyCycle(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+	s.Add(process.Service{Name: "a", Deps: []string{"b"}})
+	s.Add(process.Service{Name: "b", Deps: []string{"a"}})
+	err := s.Run(context.Background())
+	if !a.NotNil(err) {
+		t.FailNow()
+	}
+	a.Contains(err.Error(), "cycle")
+
+	s = testSupervisor(nil)
+	s.Add(process.Service{Name: "a", Deps: []string{"missing"}})
+	a.NotNil(s.Run(context.Background()))
+}
+
+func TestSupervisorKilled(t *testing.T) {
+	a := assert.New(t)
+	p := process.P{Log: zap.NewNop().Sugar()}
+	s := testSupervisor(nil)
+	s.Add(process.Service{Name: "stubborn", Policy: process.RestartAlways, Run: func(ctx context.Context) error {
+		return p.ExecContext(ctx, "stubborn", "sh", []string{"-c", `trap "" TERM; exec sleep 10`},
+			process.Stop{GracePeriod: time.Millisecond * 100})
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	err := s.Run(ctx)
+	a.Equal(process.ErrKilled, errors.Cause(err))
+	a.Contains(err.Error(), "stubborn")
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	var runs int32
+	s.Add(process.Service{Name: "node", Policy: process.RestartNever, Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		<-ctx.Done()
+		return errors.New("signal: interrupt")
+	}})
+	a.NotNil(s.Restart("node"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	for atomic.LoadInt32(&runs) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// restarted whatever its policy
+	a.Nil(s.Restart("node"))
+	for atomic.LoadInt32(&runs) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	a.Equal(process.StateRunning, statusOf(s, "node").State)
+	a.Equal(1, statusOf(s, "node").Restarts)
+
+	cancel()
+	a.Nil(<-done)
+	a.Equal(int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestSupervisorReadiness(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	socket := filepath.Join(t.TempDir(), "node.socket")
+	var sidecarStarted int32
+	s.Add(process.Service{Name: "node", Policy: process.RestartAlways, Ready: process.ReadyFile(socket),
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}})
+	s.Add(process.Service{Name: "sidecar", Policy: process.RestartAlways, Deps: []string{"node"},
+		Run: func(ctx context.Context) error {
+			atomic.StoreInt32(&sidecarStarted, 1)
+			<-ctx.Done()
+			return nil
+		}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	// the sidecar waits for the node to be ready
+	time.Sleep(time.Millisecond * 50)
+	a.Equal(int32(0), atomic.LoadInt32(&sidecarStarted))
+	a.Equal(process.StateRunning, statusOf(s, "node").State)
+	a.False(statusOf(s, "node").Ready)
+
+	if !a.Nil(ioutil.WriteFile(socket, nil, 0600)) {
+		t.FailNow()
+	}
+	for atomic.LoadInt32(&sidecarStarted) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	a.True(statusOf(s, "node").Ready)
+	a.True(statusOf(s, "sidecar").Ready)
+
+	cancel()
+	a.Nil(<-done)
+}
+
+func TestSupervisorNeverReady(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	s.Add(process.Service{Name: "node", Policy: process.RestartAlways,
+		Ready: func(ctx context.Context) error { return errors.New("not yet") },
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}})
+	s.Add(process.Service{Name: "sidecar", Deps: []string{"node"}, Run: func(ctx context.Context) error {
+		t.Error("sidecar started")
+		return nil
+	}})
+
+	// shutting down does not wait for the node to be ready
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Nil(s.Run(ctx))
+	a.Equal(process.StateStopped, statusOf(s, "sidecar").State)
+}
+
+func TestSupervisorDependencyStopped(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	s.Add(process.Service{Name: "node", Policy: process.RestartNever,
+		Ready: func(ctx context.Context) error { return errors.New("not yet") },
+		Run: func(ctx context.Context) error {
+			return errors.New("no config")
+		}})
+	s.Add(process.Service{Name: "sidecar", Deps: []string{"node"}, Run: func(ctx context.Context) error {
+		t.Error("sidecar started")
+		return nil
+	}})
+	s.Add(process.Service{Name: "watcher", Deps: []string{"sidecar"}, Run: func(ctx context.Context) error {
+		t.Error("watcher started")
+		return nil
+	}})
+
+	// the dependents of a service that stopped before it was ready fail and
+	// Run returns once nothing is left running
+	done := make(chan error)
+	go func() { done <- s.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		a.Nil(err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run did not return")
+	}
+	a.Equal(process.StateFailed, statusOf(s, "node").State)
+	a.Equal(process.StateFailed, statusOf(s, "sidecar").State)
+	a.Equal("dependency node stopped before it was ready", statusOf(s, "sidecar").LastError)
+	a.Equal(process.StateFailed, statusOf(s, "watcher").State)
+}
+
+func TestSupervisorStopBefore(t *testing.T) {
+	a := assert.New(t)
+	s := testSupervisor(nil)
+
+	stopped := make(chan string, 2)
+	var exporterStarted int32
+	s.Add(process.Service{Name: "node", Policy: process.RestartAlways,
+		Ready: func(ctx context.Context) error { return errors.New("revalidating") },
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped <- "node"
+			return nil
+		}})
+	s.Add(process.Service{Name: "exporter", StopBefore: []string{"node"}, Run: func(ctx context.Context) error {
+		atomic.StoreInt32(&exporterStarted, 1)
+		<-ctx.Done()
+		stopped <- "exporter"
+		return nil
+	}})
+
+	// the exporter does not wait for the node to be ready but is stopped
+	// before it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Nil(s.Run(ctx))
+	a.Equal(int32(1), atomic.LoadInt32(&exporterStarted))
+	a.Equal("exporter", <-stopped)
+	a.Equal("node", <-stopped)
+}
@@ -1,13 +1,15 @@
 package prometheuscfg
 
 import (
+	"context"
 	"fmt"
+	"syscall"
 
 	"github.com/adakailabs/gocnode/runner/gen"
+	"github.com/adakailabs/gocnode/runner/process"
 
 	"github.com/adakailabs/gocnode/config"
 	l "github.com/adakailabs/gocnode/logger"
-	"github.com/k0kubun/pp"
 )
 
 type R struct {
@@ -21,17 +23,25 @@ func NewPrometheusRunner(conf *config.C, nodeID int, isProducer bool) (r *R, err
 		return r, err
 	}
 	r.P.Log = r.Log
-	r.Cmd0Path = "prometheus"
-	r.Cmd0Args = make([]string, 0, 10)
-	r.Cmd0Args = append(r.Cmd0Args,
-		"--storage.tsdb.path=/prometheus",
-		"--web.console.libraries=/usr/share/prometheus/console_libraries",
-		"--web.console.templates=/usr/share/prometheus/consoles")
+	if err = r.InitRouter(); err != nil {
+		return r, err
+	}
+	r.AddService(gen.Service{
+		Name: config.ServicePrometheus,
+		Path: "prometheus",
+		Args: []string{
+			"--storage.tsdb.path=/prometheus",
+			"--web.console.libraries=/usr/share/prometheus/console_libraries",
+			"--web.console.templates=/usr/share/prometheus/consoles",
+		},
+		Stop:  process.Stop{Signal: syscall.SIGTERM, GracePeriod: r.C.Shutdown.SidecarGracePeriod},
+		Ready: process.ReadyHTTP("http://127.0.0.1:9090/-/ready"),
+	})
 
 	return r, err
 }
 
-func (r *R) StartPrometheus() error {
+func (r *R) StartPrometheus(ctx context.Context) error {
 	r.Log.Info("starting prometheus")
 
 	d, err := New(r.C)
@@ -44,19 +54,22 @@ func (r *R) StartPrometheus() error {
 		return err
 	}
 
-	r.Cmd0Args = append(r.Cmd0Args, fmt.Sprintf("--config.file=%s", file))
+	svc := r.Service(config.ServicePrometheus)
+	svc.Args = append(svc.Args, fmt.Sprintf("--config.file=%s", file))
 
-	r.Log.Info(pp.Sprint(r.Cmd0Args))
-
-	cmdsErr := make(chan error)
+	r.ConfigureServices(r.C.Services)
+	if err = r.CheckServices(); err != nil {
+		return err
+	}
 
-	go func() {
-		if er := r.P.Exec("prometheus", r.Cmd0Path, r.Cmd0Args, r.Cmd0); er != nil {
-			cmdsErr <- er
-		}
-	}()
+	if err = r.InitLogFiles(r.C.LogFiles, r.ServiceNames()...); err != nil {
+		return err
+	}
+	defer r.CloseOutput()
 
-	err = <-cmdsErr
+	sup := process.NewSupervisor(r.Log, r.C.Supervisor)
+	r.Supervise(sup)
+	sup.Add(process.Service{Name: "log_rules_watcher", Policy: process.RestartOnFailure, Run: r.WatchLogRules})
 
-	return err
+	return sup.Run(ctx)
 }
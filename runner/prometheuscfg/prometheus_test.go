@@ -1,14 +1,20 @@
 package prometheuscfg_test
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	prometheuscfg2 "github.com/adakailabs/gocnode/runner/prometheuscfg"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/runner/process"
 )
 
 func TestMain(m *testing.M) {
@@ -28,3 +34,52 @@ func TestConfig(t *testing.T) {
 
 	p.GetYaml()
 }
+
+const startConfig = `
+services:
+  prometheus:
+    path: sh
+relays:
+  - pool: "test"
+    host: "relay0.example.com"
+    network: "mainnet"
+    port: 3001
+`
+
+func TestStartPrometheus(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "gocnode.yaml")
+	if !a.Nil(ioutil.WriteFile(path, []byte(startConfig), 0o600)) {
+		t.FailNow()
+	}
+	c, err := config.New(path, true, "debug")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	r, err := prometheuscfg2.NewPrometheusRunner(c, 0, false)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	fake := process.NewFakeExecutor()
+	r.P.Executor = fake
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.StartPrometheus(ctx) }()
+
+	var p *process.FakeProcess
+	select {
+	case p = <-fake.Started():
+	case <-time.After(time.Second * 10):
+		t.Fatal("prometheus not started")
+	}
+	a.Equal(config.ServicePrometheus, p.Spec.Name)
+	a.Equal("sh", p.Spec.Path)
+	a.Equal("--storage.tsdb.path=/prometheus", p.Spec.Args[0])
+	a.Equal("--config.file=/prometheus/prometheus.yaml", p.Spec.Args[len(p.Spec.Args)-1])
+
+	cancel()
+	a.Nil(<-done)
+	a.Equal([]os.Signal{syscall.SIGTERM}, p.Signals())
+}
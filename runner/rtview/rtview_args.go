@@ -1,12 +1,14 @@
 package rtview
 
 import (
+	"context"
 	"fmt"
+	"syscall"
 
 	"github.com/adakailabs/gocnode/config"
 	l "github.com/adakailabs/gocnode/logger"
 	"github.com/adakailabs/gocnode/runner/gen"
-	"github.com/k0kubun/pp"
+	"github.com/adakailabs/gocnode/runner/process"
 )
 
 type R struct {
@@ -20,16 +22,23 @@ func NewRtViewRunner(conf *config.C) (r *R, err error) {
 		return r, err
 	}
 	r.P.Log = r.Log
-	r.Cmd0Path = "/usr/local/rt-view/cardano-rt-view"
-	r.Cmd0Args = make([]string, 0, 10)
-	r.Cmd0Args = append(r.Cmd0Args,
-		"--static",
-		"/usr/local/rt-view/static")
+	if err = r.InitRouter(); err != nil {
+		return r, err
+	}
+	r.AddService(gen.Service{
+		Name: config.ServiceRtView,
+		Path: "/usr/local/rt-view/cardano-rt-view",
+		Args: []string{
+			"--static",
+			"/usr/local/rt-view/static",
+		},
+		Stop: process.Stop{Signal: syscall.SIGTERM, GracePeriod: r.C.Shutdown.SidecarGracePeriod},
+	})
 
 	return r, err
 }
 
-func (r *R) StartRtView() error {
+func (r *R) StartRtView(ctx context.Context) error {
 	r.Log.Info("starting rtview")
 
 	d, err := New(r.C)
@@ -42,24 +51,27 @@ func (r *R) StartRtView() error {
 		return err
 	}
 	// --port 8666 --config $CONFIG_FILE_LOCAL
-	r.Cmd0Args = append(r.Cmd0Args,
+	svc := r.Service(config.ServiceRtView)
+	svc.Args = append(svc.Args,
 		"--port",
 		fmt.Sprintf("%d", 8666),
 
 		"--config",
 		file)
 
-	r.Log.Info(pp.Sprint(r.Cmd0Args))
-
-	cmdsErr := make(chan error)
+	r.ConfigureServices(r.C.Services)
+	if err = r.CheckServices(); err != nil {
+		return err
+	}
 
-	go func() {
-		if er := r.P.Exec("rtview", r.Cmd0Path, r.Cmd0Args, r.Cmd0); er != nil {
-			cmdsErr <- er
-		}
-	}()
+	if err = r.InitLogFiles(r.C.LogFiles, r.ServiceNames()...); err != nil {
+		return err
+	}
+	defer r.CloseOutput()
 
-	err = <-cmdsErr
+	sup := process.NewSupervisor(r.Log, r.C.Supervisor)
+	r.Supervise(sup)
+	sup.Add(process.Service{Name: "log_rules_watcher", Policy: process.RestartOnFailure, Run: r.WatchLogRules})
 
-	return err
+	return sup.Run(ctx)
 }
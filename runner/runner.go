@@ -1,9 +1,15 @@
 package runner
 
 import (
+	"github.com/adakailabs/gocnode/config"
 	"github.com/adakailabs/gocnode/runner/gen"
+	"github.com/adakailabs/gocnode/runner/node"
 )
 
 type R struct {
 	gen.R
 }
+
+func NewCardanoNodeRunner(conf *config.C, nodeID int, isProducer, passive bool) (*node.R, error) {
+	return node.NewCardanoNodeRunner(conf, nodeID, isProducer, passive)
+}
@@ -1,6 +1,7 @@
 package runner_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -24,6 +25,6 @@ func TestConfig(t *testing.T) {
 	r, err := runner.NewCardanoNodeRunner(c, 2, false, false)
 	a.Nil(err)
 
-	err = r.StartCnode()
+	err = r.StartCnode(context.Background())
 	a.Nil(err)
 }
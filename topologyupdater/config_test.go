@@ -1,6 +1,7 @@
 package topologyupdater_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -47,7 +48,7 @@ func TestPing(t *testing.T) {
 	d, err2 := cardanocfg.New(&c.Relays[nodeID], c)
 	a.Nil(err2)
 
-	_, _, _, _, _ = d.DownloadConfigFiles()
+	_, err = d.DownloadConfigFiles(context.Background())
 	a.Nil(err)
 
 	tu, err := topologyupdater.New(c, nodeID)
@@ -31,6 +31,7 @@ type TU struct {
 	testMode bool
 	log      *zap.SugaredLogger
 	client   *resty.Client
+	filter   *cardanocfg.PeerFilter
 }
 
 func New(c *config.C, nodeID int) (tu *TU, err error) {
@@ -44,15 +45,57 @@ func New(c *config.C, nodeID int) (tu *TU, err error) {
 	}
 	tu.node = c.Relays[nodeID]
 	tu.client = resty.New()
+	if tu.filter, err = cardanocfg.NewPeerFilter(tu.node.PeerFilter); err != nil {
+		return tu, err
+	}
 	return tu, err
 }
 
+// GetTopology fetches peers from the topology updater service, for dual
+// stack nodes both the IPv4 and IPv6 lists are fetched and merged.
 func (t *TU) GetTopology() (UpdaterGetNodes, error) {
+	var families []uint
+	switch t.node.IPFamily {
+	case config.IPv6:
+		families = []uint{6}
+	case config.DualStack:
+		families = []uint{4, 6}
+	default:
+		families = []uint{4}
+	}
+
+	toReturn := UpdaterGetNodes{}
+	for _, ipv := range families {
+		nodes, err := t.getTopology(ipv)
+		if err != nil {
+			return toReturn, err
+		}
+		producers := append(toReturn.Producers, nodes.Producers...)
+		toReturn = nodes
+		toReturn.Producers = producers
+	}
+
+	toReturn.Producers = t.FilterPeers(toReturn.Producers)
+	return toReturn, nil
+}
+
+// FilterPeers applies the node's allow and block lists to nodes and adds
+// the node's pinned peers.
+func (t *TU) FilterPeers(nodes []cardanocfg.Node) []cardanocfg.Node {
+	filtered := t.filter.Apply(nodes)
+	for _, p := range t.filter.Pinned() {
+		p.Internal = true
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+func (t *TU) getTopology(ipv uint) (UpdaterGetNodes, error) {
 	url := fmt.Sprintf("%s/fetch/?max=%d&magic=%d&ipv=%d",
 		APIURL,
 		t.node.Peers,
 		t.node.NetworkMagic,
-		4)
+		ipv)
 
 	resp, err := t.client.R().
 		EnableTrace().
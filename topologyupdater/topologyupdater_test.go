@@ -0,0 +1,55 @@
+package topologyupdater_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adakailabs/gocnode/cardanocfg"
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/topologyupdater"
+)
+
+const filterConfig = `
+relays:
+  - pool: "test"
+    host: "relay0.example.com"
+    network: "mainnet"
+    port: 3001
+    peer_filter:
+      block: ["bad.example.com"]
+      pinned:
+        - host: "friend.example.org"
+          port: 3001
+`
+
+func TestFilterPeers(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "gocnode.yaml")
+	if !a.Nil(ioutil.WriteFile(path, []byte(filterConfig), 0o600)) {
+		t.FailNow()
+	}
+	c, err := config.New(path, true, "debug")
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	tu, err := topologyupdater.New(c, 0)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+
+	// the pinned peer is added once, also when the service returns it
+	nodes := tu.FilterPeers([]cardanocfg.Node{
+		{Addr: "good.example.com", Port: 3001},
+		{Addr: "bad.example.com", Port: 3001},
+		{Addr: "friend.example.org", Port: 3001},
+	})
+	if a.Len(nodes, 2) {
+		a.Equal("good.example.com", nodes[0].Addr)
+		a.Equal("friend.example.org", nodes[1].Addr)
+		a.True(nodes[1].Internal)
+	}
+}
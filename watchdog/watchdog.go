@@ -0,0 +1,227 @@
+// Package watchdog watches the chain tip of a node and takes escalating
+// actions when it stops advancing.
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/nodemetrics"
+)
+
+// Kinds of action, in escalation order
+const (
+	ActionAlert      = "alert"
+	ActionRegenerate = "regenerate_topology"
+	ActionRestart    = "restart_node"
+)
+
+// Action is an action taken by the watchdog.
+type Action struct {
+	Time       time.Time     `json:"time"`
+	Node       string        `json:"node"`
+	Kind       string        `json:"kind"`
+	Block      uint64        `json:"block"`
+	Slot       uint64        `json:"slot"`
+	StalledFor time.Duration `json:"stalled_for"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Watchdog takes the actions of its config when the tip of a node does
+// not advance.
+type Watchdog struct {
+	conf       config.Watchdog
+	node       string
+	tracker    *nodemetrics.Tracker
+	regenerate func(ctx context.Context) error
+	restart    func() error
+	client     *http.Client
+	log        *zap.SugaredLogger
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	actions []Action
+}
+
+// New returns the watchdog of node n, whose tip is tracked by tracker.
+// regenerate regenerates the topology of the node and restart restarts
+// cardano-node. cardano-node only reads its topology when it starts, so the
+// regenerate action restarts it too.
+func New(log *zap.SugaredLogger, n *config.Node, tracker *nodemetrics.Tracker,
+	regenerate func(ctx context.Context) error, restart func() error) *Watchdog {
+	return &Watchdog{
+		conf:       n.Watchdog,
+		node:       n.Name,
+		tracker:    tracker,
+		regenerate: regenerate,
+		restart:    restart,
+		client:     &http.Client{Timeout: time.Second * 10},
+		log:        log,
+		last:       make(map[string]time.Time),
+	}
+}
+
+// Check takes the actions that are due for the current stall, if any, and
+// returns them.
+func (w *Watchdog) Check(ctx context.Context) []Action {
+	tip, _ := w.tracker.Tip()
+	if tip.AdvancedAt.IsZero() {
+		// nothing scraped yet, the tracker keeps AdvancedAt when scrapes
+		// fail so a node that stops answering counts as stalled
+		return nil
+	}
+	now := time.Now()
+	stalledFor := now.Sub(tip.AdvancedAt)
+
+	levels := []struct {
+		kind  string
+		after time.Duration
+		take  func() error
+	}{
+		{ActionAlert, w.conf.StallAfter, func() error { return w.alert(ctx, tip, stalledFor) }},
+		{ActionRegenerate, w.conf.RegenerateAfter, func() error { return w.regenerateAndRestart(ctx) }},
+		{ActionRestart, w.conf.RestartAfter, w.restart},
+	}
+
+	var taken []Action
+	for _, l := range levels {
+		if stalledFor < l.after || !w.due(l.kind, now) {
+			continue
+		}
+		a := Action{
+			Time:       now,
+			Node:       w.node,
+			Kind:       l.kind,
+			Block:      tip.Block,
+			Slot:       tip.Slot,
+			StalledFor: stalledFor,
+		}
+		if err := l.take(); err != nil {
+			a.Error = err.Error()
+			w.log.Errorf("watchdog %s of %s failed: %s", a.Kind, w.node, a.Error)
+		} else if a.Kind != ActionAlert {
+			w.log.Warnf("watchdog took %s on %s, tip stalled at block %d for %v",
+				a.Kind, w.node, a.Block, stalledFor.Round(time.Second))
+		}
+		w.record(a)
+		taken = append(taken, a)
+	}
+	return taken
+}
+
+// regenerateAndRestart regenerates the topology and restarts cardano-node
+// so that it loads it.
+func (w *Watchdog) regenerateAndRestart(ctx context.Context) error {
+	if err := w.regenerate(ctx); err != nil {
+		return err
+	}
+	return w.restart()
+}
+
+// due reports whether action kind was not taken within min_action_interval
+// and, if so, marks it taken at now.
+func (w *Watchdog) due(kind string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if last, ok := w.last[kind]; ok && now.Sub(last) < w.conf.MinInterval {
+		return false
+	}
+	w.last[kind] = now
+	return true
+}
+
+func (w *Watchdog) alert(ctx context.Context, tip nodemetrics.Tip, stalledFor time.Duration) error {
+	w.log.Errorf("tip of %s stalled at block %d, slot %d for %v",
+		w.node, tip.Block, tip.Slot, stalledFor.Round(time.Second))
+	if w.conf.AlertWebhook == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"node":        w.node,
+		"block":       tip.Block,
+		"slot":        tip.Slot,
+		"stalled_for": stalledFor.Round(time.Second).String(),
+		"text":        fmt.Sprintf("tip of %s stalled at block %d for %v", w.node, tip.Block, stalledFor.Round(time.Second)),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.conf.AlertWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("posting alert to %s: %s", w.conf.AlertWebhook, resp.Status)
+	}
+	return nil
+}
+
+// record keeps a in the history and appends it to the record file.
+func (w *Watchdog) record(a Action) {
+	w.mu.Lock()
+	w.actions = append(w.actions, a)
+	if over := len(w.actions) - int(w.conf.History); w.conf.History > 0 && over > 0 {
+		w.actions = append([]Action(nil), w.actions[over:]...)
+	}
+	w.mu.Unlock()
+
+	if w.conf.RecordFile == "" {
+		return
+	}
+	if err := appendJSON(w.conf.RecordFile, a); err != nil {
+		w.log.Errorf("recording watchdog action: %s", err.Error())
+	}
+}
+
+func appendJSON(file string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(f).Encode(v); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Actions returns the last actions taken, oldest first.
+func (w *Watchdog) Actions() []Action {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Action(nil), w.actions...)
+}
+
+// Run checks the tip every check_interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.conf.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		w.Check(ctx)
+	}
+}
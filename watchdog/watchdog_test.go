@@ -0,0 +1,124 @@
+package watchdog_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/adakailabs/gocnode/config"
+	"github.com/adakailabs/gocnode/nodemetrics"
+	"github.com/adakailabs/gocnode/watchdog"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+func TestWatchdogEscalation(t *testing.T) {
+	a := assert.New(t)
+
+	block := 5798765
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "cardano_node_metrics_blockNum_int %d\ncardano_node_metrics_slotNum_int %d\n", block, block*5)
+	}))
+	defer srv.Close()
+
+	alerts := make(chan map[string]interface{}, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := make(map[string]interface{})
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		alerts <- m
+	}))
+	defer hook.Close()
+
+	record := filepath.Join(t.TempDir(), "watchdog.jsonl")
+	n := &config.Node{Name: "relay0", Watchdog: config.Watchdog{
+		StallAfter:      time.Millisecond * 200,
+		RegenerateAfter: time.Second,
+		RestartAfter:    time.Millisecond * 1200,
+		MinInterval:     time.Hour,
+		AlertWebhook:    hook.URL,
+		History:         2,
+		RecordFile:      record,
+	}}
+	tracker := nodemetrics.NewTracker(srv.URL, time.Second)
+	regenerations, restarts := 0, 0
+	w := watchdog.New(zap.NewNop().Sugar(), n, tracker,
+		func(ctx context.Context) error { regenerations++; return nil },
+		func() error { restarts++; return errors.New("not running") })
+
+	ctx := context.Background()
+	// nothing scraped yet
+	a.Empty(w.Check(ctx))
+
+	_, err := tracker.Scrape(ctx)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	a.Empty(w.Check(ctx))
+
+	// the thresholds leave room for slow test runs, the tip is between
+	// 300ms and 1s old
+	time.Sleep(time.Millisecond * 300)
+	taken := w.Check(ctx)
+	if a.Len(taken, 1) {
+		a.Equal(watchdog.ActionAlert, taken[0].Kind)
+		a.Equal(uint64(5798765), taken[0].Block)
+	}
+	select {
+	case alert := <-alerts:
+		a.Equal("relay0", alert["node"])
+	case <-time.After(time.Second * 5):
+		t.Fatal("no alert posted")
+	}
+
+	time.Sleep(time.Millisecond * 1200)
+	taken = w.Check(ctx)
+	// the alert is rate-limited
+	if a.Len(taken, 2) {
+		a.Equal(watchdog.ActionRegenerate, taken[0].Kind)
+		a.Equal("not running", taken[0].Error)
+		a.Equal(watchdog.ActionRestart, taken[1].Kind)
+		a.Equal("not running", taken[1].Error)
+	}
+	a.Equal(1, regenerations)
+	// the regeneration restarts cardano-node to load the topology
+	a.Equal(2, restarts)
+	a.Empty(w.Check(ctx))
+
+	// the history keeps the last 2 actions, the file all of them
+	actions := w.Actions()
+	if a.Len(actions, 2) {
+		a.Equal(watchdog.ActionRegenerate, actions[0].Kind)
+	}
+	f, err := os.Open(record)
+	if !a.Nil(err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	var kinds []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var act watchdog.Action
+		a.Nil(json.Unmarshal(s.Bytes(), &act))
+		kinds = append(kinds, act.Kind)
+	}
+	a.Equal([]string{watchdog.ActionAlert, watchdog.ActionRegenerate, watchdog.ActionRestart}, kinds)
+
+	// the tip advances
+	block++
+	_, err = tracker.Scrape(ctx)
+	a.Nil(err)
+	a.Empty(w.Check(ctx))
+}